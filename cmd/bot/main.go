@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // часовой пояс салона не должен зависеть от базы зон в образе
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/domain/bot/notify"
+	"github.com/napryag/tg_services_bot/pkg/domain/bot/outbox"
 	"github.com/napryag/tg_services_bot/pkg/domain/bot/receiver"
 	"github.com/napryag/tg_services_bot/pkg/domain/bot/receiver/config"
+	"github.com/napryag/tg_services_bot/pkg/domain/bot/receiver/store"
+	"github.com/napryag/tg_services_bot/pkg/domain/bot/reminder"
+	"github.com/napryag/tg_services_bot/pkg/domain/bot/sender"
 	"github.com/napryag/tg_services_bot/pkg/utils/errs"
 	"github.com/rs/zerolog"
 )
@@ -38,7 +46,51 @@ func main() {
 		return
 	}
 
-	store := receiver.NewStore()
+	repo, err := store.NewRepo(ctx, cfg.DSN())
+	if err != nil {
+		logger.Error().Err(err).Msg("connect postgres")
+		return
+	}
+	defer repo.Close()
+
+	var sessions receiver.SessionStore = receiver.NewPGStore(repo)
+	if cfg.SessionStore == config.SessionStoreMemory {
+		sessions = receiver.NewMemoryStore()
+	}
+
+	var procCfg sender.ProcessorConfig
+	if err := procCfg.LoadFromEnv(); err != nil {
+		logger.Error().Err(err).Msg("staff channel config")
+		return
+	}
+
+	// Все исходящие запросы бота идут через общий лимитер и классификатор ошибок
+	client := sender.NewClient(bot, sender.NewLimiter(), logger)
+
+	codec := receiver.NewCodec(cfg.CallbackSecret, cfg.CallbackTTL)
+	proc := sender.New(procCfg, logger, client)
+	staff := notify.New(proc, repo, codec, cfg.Location)
+	policy := receiver.BookingPolicy{
+		Grid:           cfg.SlotGrid,
+		MinLead:        cfg.MinBookingLead,
+		HorizonDays:    cfg.BookingHorizonDays,
+		ChangeDeadline: cfg.ChangeDeadline,
+	}
+	router := receiver.NewRouter()
+	router.Use(
+		receiver.Logging(),
+		receiver.AnswerCallback(),
+		receiver.Recovery(),
+		receiver.Auth(),
+		receiver.Render(receiver.NewRenderer(repo, cfg.Location, policy), codec),
+		receiver.VerifyCallback(codec),
+	)
+	receiver.NewHandlers(
+		repo, cfg.Location, policy, cfg.SlotHoldTTL,
+		receiver.AssignRule(cfg.MasterAssignment), procCfg.IsChannel,
+	).Register(router)
+	dedup := receiver.NewDedup(repo, logger)
+	handler := receiver.NewBot(client, sessions, router, codec, dedup, repo, logger)
 
 	bot.Debug = false
 
@@ -48,136 +100,92 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 10
-	updates := bot.GetUpdatesChan(u)
+	updates, err := receiveUpdates(ctx, cfg, bot, client, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("start receiving updates")
+		return
+	}
 
-	// Горутина для корректного завершения
-	go func() {
-		<-ctx.Done()
-		logger.Info().Msg("shutting down bot")
-		// Останавливаем лонг-поллинг -> канал updates закроется, цикл ниже завершится
-		bot.StopReceivingUpdates()
-	}()
+	go dedup.Run(ctx)
+	go outbox.New(repo, proc, staff, logger).Run(ctx)
+	go reminder.New(repo, client, cfg.ReminderLeads, cfg.Location, logger).Run(ctx)
 
-	for update := range updates {
-		if m := update.Message; m != nil {
-			userID := m.From.ID
-			sess := store.Get(userID)
-
-			// если это /start — обработали и уходим к след. апдейту
-			if handled := handleStartCommand(m, sess, bot, logger, update); handled {
-				continue
-			}
-
-			// Любой произвольный текст — удаляем (если возможно) и напоминаем
-			_, _ = bot.Request(tgbotapi.NewDeleteMessage(m.Chat.ID, m.MessageID))
-
-			remind := tgbotapi.NewMessage(m.Chat.ID, "Пожалуйста, используйте кнопки 👆")
-			sent, _ := bot.Send(remind)
-			go func(chatID int64, mid int) {
-				time.Sleep(5 * time.Second)
-				_, _ = bot.Request(tgbotapi.NewDeleteMessage(chatID, mid))
-			}(sent.Chat.ID, sent.MessageID)
-			continue
-		}
-		// Нажатия на inline-кнопки
-		if cq := update.CallbackQuery; cq != nil {
-			userID := cq.From.ID
-			sess := store.Get(userID)
-			data := cq.Data
-
-			switch {
-			case data == receiver.CbStart:
-				sess.Go(receiver.StateMain)
-			case data == receiver.CbBook:
-				sess.Go(receiver.StateBookService)
-			case data == receiver.CbMy:
-				sess.Go(receiver.StateMy)
-			case data == receiver.CbHelp:
-				sess.Go(receiver.StateHelp)
-			case data == receiver.CbBack:
-				sess.Back()
-
-			case strings.HasPrefix(data, receiver.PSvc):
-				val, _ := receiver.Is(data, receiver.PSvc)
-				sess.Booking.Service = val
-				sess.Go(receiver.StateBookMaster)
-
-			case strings.HasPrefix(data, receiver.PM):
-				val, _ := receiver.Is(data, receiver.PM)
-				sess.Booking.Master = val
-				sess.Go(receiver.StateBookDate)
-
-			case strings.HasPrefix(data, receiver.PD):
-				val, _ := receiver.Is(data, receiver.PD)
-				sess.Booking.Date = val
-				sess.Go(receiver.StateBookTime)
-
-			case strings.HasPrefix(data, receiver.PT):
-				val, _ := receiver.Is(data, receiver.PT)
-				sess.Booking.Time = val
-				sess.Go(receiver.StateBookConfirm)
-
-			case data == receiver.CbOk:
-				// TODO: здесь сохраняем запись в вашу БД/сервис
-				// booking := sess.Booking
-				// err := appointmentsService.Create(booking)
-				// ...
-				text := fmt.Sprintf("Готово! Вы записаны: %s, %s, %s, %s.",
-					receiver.Title(sess.Booking.Service), receiver.Title(sess.Booking.Master),
-					receiver.HumanDate(sess.Booking.Date), sess.Booking.Time,
-				)
-				sess.ResetFlow() // возвращаемся в главное меню
-
-				edit := tgbotapi.NewEditMessageTextAndMarkup(
-					cq.Message.Chat.ID, cq.Message.MessageID, text, receiver.MainMenu(),
-				)
-				_, _ = bot.Send(edit)
-
-				// Гасим "часики"
-				_, _ = bot.Request(tgbotapi.NewCallback(cq.ID, ""))
-				continue
-			}
-
-			// Рендерим текущий экран (редактируем то же сообщение)
-			capt, rep := receiver.NewEditMessageCaptionAndMarkup(
-				cq.Message.Chat.ID, cq.Message.MessageID, receiver.RenderText(sess), receiver.RenderKeyboard(sess),
-			)
-			if _, err := bot.Send(capt); err != nil {
-				log.Printf("cap error: %v", err)
-			}
-			if _, err := bot.Send(rep); err != nil {
-				log.Printf("rep error: %v", err)
-			}
-			_, _ = bot.Request(tgbotapi.NewCallback(cq.ID, ""))
-		}
-	}
+	receiver.NewDispatcher(cfg.WorkerCount, handler.HandleUpdate).Run(ctx, updates)
 	logger.Info().Msg("bot stopped")
 }
 
-func handleStartCommand(
-	m *tgbotapi.Message,
-	sess *receiver.Session,
+// receiveUpdates запускает long polling или webhook-сервер (по cfg.Mode). Канал закрывается
+// после отмены ctx, когда приём апдейтов остановлен.
+func receiveUpdates(
+	ctx context.Context,
+	cfg *config.Config,
 	bot *tgbotapi.BotAPI,
+	client *sender.Client,
 	logger zerolog.Logger,
-	update tgbotapi.Update,
-) bool {
-	if m.IsCommand() && m.Command() == "start" {
-		sess.ResetFlow()
-		sess.State = receiver.StateStart
-		if _, err := bot.Request(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID)); err != nil {
-			logger.Warn().Err(err).Msg("delete /start failed")
+) (tgbotapi.UpdatesChannel, error) {
+	if cfg.Mode != config.ModeWebhook {
+		if err := receiver.DeleteWebhook(ctx, client); err != nil {
+			return nil, err
 		}
-		msg := tgbotapi.NewPhoto(update.Message.Chat.ID, tgbotapi.FilePath("pictures/logo.png"))
-		msg.Caption = fmt.Sprintf("<b>Приветствую %s!\n"+
-			"Данный чат-бот поможет Вам записаться на услуги барбера. Здесь вы можете отслеживать свои записи и т.д.\n"+
-			"Для того, чтобы начать работу с нашим ботом нажмите НАЧАТЬ</b>😺", m.From.FirstName)
-		msg.ParseMode = "HTML"
-		msg.ReplyMarkup = receiver.RenderKeyboard(sess)
-		if _, err := bot.Send(msg); err != nil {
-			logger.Printf("send start menu error: %v", err)
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 10
+		updates := bot.GetUpdatesChan(u)
+
+		// Горутина для корректного завершения
+		go func() {
+			<-ctx.Done()
+			logger.Info().Msg("shutting down bot")
+			// Останавливаем лонг-поллинг -> канал updates закроется, цикл обработки завершится
+			bot.StopReceivingUpdates()
+		}()
+		return updates, nil
+	}
+
+	link, err := url.Parse(cfg.WebhookURL)
+	if err != nil {
+		return nil, errs.New("invalid webhook url").Wrap(err)
+	}
+	path := link.Path
+	if path == "" {
+		path = "/" // https://example.com — вебхук в корне
+	}
+	// Порт занимаем сразу: если он занят, бот не стартует, а не работает молча без апдейтов
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.HTTPPort))
+	if err != nil {
+		return nil, errs.New("failed to listen webhook port").Arg("port", cfg.HTTPPort).Wrap(err)
+	}
+	wh := receiver.NewWebhook(cfg.WebhookSecret, bot.Buffer, logger)
+	mux := http.NewServeMux()
+	mux.Handle(path, wh)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Сервер упал — останавливаем приём: канал апдейтов закроется и бот завершится
+	serveCtx, stopServe := context.WithCancel(ctx)
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error().Err(err).Msg("webhook server")
+			stopServe()
+		}
+	}()
+	go func() {
+		<-serveCtx.Done()
+		logger.Info().Msg("shutting down bot")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Warn().Err(err).Msg("webhook server shutdown")
 		}
+		// Хендлеры завершены — больше никто не пишет в канал
+		wh.Close()
+	}()
+
+	if err := receiver.SetWebhook(ctx, client, cfg.WebhookURL, cfg.WebhookSecret); err != nil {
+		stopServe()
+		return nil, err
 	}
-	return false
+	logger.Info().Str("url", cfg.WebhookURL).Int("port", cfg.HTTPPort).Msg("webhook registered")
+	return wh.Updates(), nil
 }
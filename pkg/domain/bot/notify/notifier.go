@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/domain/bot/outbox"
+	"github.com/napryag/tg_services_bot/pkg/domain/bot/receiver"
+	"github.com/napryag/tg_services_bot/pkg/domain/bot/sender"
+	"github.com/napryag/tg_services_bot/pkg/repository/model"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+)
+
+// staffButtonTTL — срок жизни кнопок на постах: «Не пришёл» нажимают уже после начала записи.
+const staffButtonTTL = 60 * 24 * time.Hour
+
+// postLease — на сколько публикация нового поста закрепляется за одним отправителем.
+const postLease = 2 * time.Minute
+
+// Notifier публикует события записей в staff-канал через sender.Processor. Первое событие
+// создаёт пост, последующие (отмена, перенос, неявка) редактируют его на месте.
+type Notifier struct {
+	proc  *sender.Processor
+	repo  model.Repo
+	codec *receiver.Codec
+	loc   *time.Location // если часовой пояс филиала неизвестен
+}
+
+var _ outbox.StaffNotifier = (*Notifier)(nil)
+
+func New(
+	proc *sender.Processor,
+	repo model.Repo,
+	codec *receiver.Codec,
+	loc *time.Location,
+) *Notifier {
+	return &Notifier{proc: proc, repo: repo, codec: codec.WithTTL(staffButtonTTL), loc: loc}
+}
+
+// Notify публикует или правит пост о записи. Блокировки на время запросов к Telegram
+// не держатся: публикацию сначала захватывает короткий UPDATE (ClaimChannelPost), и другой
+// экземпляр бота или повтор из outbox вместо второго поста получит ошибку, а при следующей
+// попытке отредактирует уже сохранённый пост.
+func (n *Notifier) Notify(ctx context.Context, event model.BookingEvent, appointmentID int64) error {
+	a, err := n.repo.GetAppointmentDetails(ctx, appointmentID)
+	if err != nil {
+		return errs.New("failed to get appointment").Arg("id", appointmentID).Wrap(err)
+	}
+	text := n.format(event, a)
+	markup, err := n.markup(ctx, a)
+	if err != nil {
+		return err
+	}
+	if a.ChannelMessageID != 0 {
+		return n.proc.Edit(ctx, a.ChannelMessageID, text, markup)
+	}
+
+	claimed, err := n.repo.ClaimChannelPost(ctx, a.ID, postLease)
+	if err != nil {
+		return errs.New("failed to claim staff post").Arg("id", a.ID).Wrap(err)
+	}
+	if !claimed {
+		return errs.New("staff post is published by another sender").Arg("id", a.ID)
+	}
+	// Публикация с сохранением id должна уложиться в захват, иначе её повторит другой отправитель.
+	// Если она не удалась, захват просто истечёт: отправлен ли пост, неизвестно
+	postCtx, cancel := context.WithTimeout(ctx, postLease/2)
+	defer cancel()
+	msgID, err := n.proc.Post(postCtx, text, markup)
+	if err != nil {
+		return err
+	}
+	if err := n.repo.SetChannelMessageID(ctx, a.ID, msgID); err != nil {
+		return errs.New("failed to save channel message id").Arg("id", a.ID).Wrap(err)
+	}
+	return nil
+}
+
+func (n *Notifier) format(event model.BookingEvent, a *model.AppointmentDetails) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s #%d\n", title(event, a.Status), a.ID)
+	fmt.Fprintf(&b, "Клиент: %s\n", a.ClientName)
+	fmt.Fprintf(&b, "Услуга: %s (%d мин, %s)\n", a.ServiceName, a.DurationMin, receiver.FormatPrice(a.PriceMinor))
+	fmt.Fprintf(&b, "Мастер: %s\n", a.MasterName)
+	fmt.Fprintf(&b, "Филиал: %s\n", a.Location.Name)
+	fmt.Fprintf(&b, "Когда: %s", a.StartAt.In(a.Location.Zone(n.loc)).Format("02.01.2006 15:04"))
+	return b.String()
+}
+
+// title — заголовок поста. Он берётся из текущего статуса записи, а не только из события:
+// событие, повторно доставленное после более нового, не откатывает пост назад.
+func title(event model.BookingEvent, status string) string {
+	switch status {
+	case "canceled":
+		return "❌ Запись отменена"
+	case "no_show":
+		return "🚫 Клиент не пришёл"
+	case "done":
+		return "✅ Визит состоялся"
+	}
+	if event == model.EventRescheduled {
+		return "🔁 Запись перенесена"
+	}
+	return "🆕 Новая запись"
+}
+
+// markup — кнопка «Не пришёл» для активной записи; у отменённой или завершённой кнопок нет.
+func (n *Notifier) markup(ctx context.Context, a *model.AppointmentDetails) (*tgbotapi.InlineKeyboardMarkup, error) {
+	if a.Status != "booked" && a.Status != "confirmed" {
+		return &tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}, nil
+	}
+	chatID, err := n.proc.ChatID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🚫 Не пришёл", receiver.PNoShow+strconv.FormatInt(a.ID, 10)),
+	))
+	if err := n.codec.SignMarkup(chatID, &markup); err != nil {
+		return nil, errs.New("failed to sign staff markup").Wrap(err)
+	}
+	return &markup, nil
+}
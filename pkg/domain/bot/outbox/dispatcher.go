@@ -0,0 +1,143 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/napryag/tg_services_bot/pkg/domain/bot/sender"
+	"github.com/napryag/tg_services_bot/pkg/repository/model"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+	"github.com/rs/zerolog"
+)
+
+// ChatSender отправляет сообщения в личный чат (обычно sender.Processor).
+type ChatSender interface {
+	SendTo(ctx context.Context, chatID int64, text string) error
+	SendVenueTo(ctx context.Context, chatID int64, title, address string, latitude, longitude float64) error
+}
+
+// StaffNotifier публикует событие записи в staff-канал (обычно notify.Notifier).
+type StaffNotifier interface {
+	Notify(ctx context.Context, event model.BookingEvent, appointmentID int64) error
+}
+
+const (
+	// pollInterval — как часто проверять outbox, когда очередь пуста.
+	pollInterval = 2 * time.Second
+	// batchSize — сколько сообщений захватывать за раз.
+	batchSize = 50
+	// lease — на сколько сообщение скрыто от других экземпляров во время отправки.
+	lease = time.Minute
+	// maxAttempts — после стольких неудач сообщение больше не отправляется.
+	maxAttempts = 10
+	// baseBackoff и maxBackoff — пауза перед повтором: baseBackoff·2^(attempts-1), не больше maxBackoff.
+	baseBackoff = 5 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// Dispatcher разбирает outbox: отправляет сообщения, записанные вместе с изменениями записей.
+// Доставка at-least-once: после падения между отправкой и MarkOutboxSent сообщение уйдёт повторно.
+type Dispatcher struct {
+	repo   model.Repo
+	chat   ChatSender
+	staff  StaffNotifier
+	logger zerolog.Logger
+}
+
+func New(repo model.Repo, chat ChatSender, staff StaffNotifier, logger zerolog.Logger) *Dispatcher {
+	return &Dispatcher{repo: repo, chat: chat, staff: staff, logger: logger}
+}
+
+// Run работает до отмены ctx.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		d.drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain отправляет пачки, пока очередь не опустеет.
+func (d *Dispatcher) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		msgs, err := d.repo.ClaimOutbox(ctx, batchSize, lease)
+		if err != nil {
+			d.logger.Error().Err(err).Msg("claim outbox")
+			return
+		}
+		for _, m := range msgs {
+			d.deliver(ctx, m)
+		}
+		if len(msgs) < batchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, m model.OutboxMessage) {
+	log := d.logger.With().Int64("outbox", m.ID).Str("kind", m.Kind).Int("attempt", m.Attempts).Logger()
+
+	err := d.send(ctx, m)
+	if err == nil || errors.Is(err, sender.ErrBlocked) {
+		// Заблокировавшему бота пользователю повторять бессмысленно
+		if err != nil {
+			log.Info().Msg("outbox message dropped: bot blocked by user")
+		}
+		if err := d.repo.MarkOutboxSent(ctx, m.ID); err != nil {
+			log.Error().Err(err).Msg("mark outbox sent")
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if m.Attempts < maxAttempts {
+		at := time.Now().Add(backoff(m.Attempts))
+		retryAt = &at
+		log.Warn().Err(err).Time("retry_at", at).Msg("send outbox message")
+	} else {
+		log.Error().Err(err).Msg("outbox message given up")
+	}
+	if err := d.repo.MarkOutboxFailed(ctx, m.ID, err.Error(), retryAt); err != nil {
+		log.Error().Err(err).Msg("mark outbox failed")
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, m model.OutboxMessage) error {
+	switch m.Kind {
+	case model.OutboxChatText:
+		var p model.ChatText
+		if err := json.Unmarshal(m.Payload, &p); err != nil {
+			return errs.New("invalid outbox payload").Wrap(err)
+		}
+		return d.chat.SendTo(ctx, p.ChatID, p.Text)
+	case model.OutboxChatVenue:
+		var p model.ChatVenue
+		if err := json.Unmarshal(m.Payload, &p); err != nil {
+			return errs.New("invalid outbox payload").Wrap(err)
+		}
+		return d.chat.SendVenueTo(ctx, p.ChatID, p.Title, p.Address, p.Latitude, p.Longitude)
+	case model.OutboxStaffEvent:
+		var p model.StaffEvent
+		if err := json.Unmarshal(m.Payload, &p); err != nil {
+			return errs.New("invalid outbox payload").Wrap(err)
+		}
+		return d.staff.Notify(ctx, p.Event, p.AppointmentID)
+	default:
+		return errs.New("unknown outbox kind").Arg("kind", m.Kind)
+	}
+}
+
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
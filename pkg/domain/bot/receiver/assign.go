@@ -0,0 +1,46 @@
+package receiver
+
+import (
+	"sort"
+	"time"
+
+	"github.com/napryag/tg_services_bot/pkg/repository/model"
+)
+
+// AssignRule — как выбрать мастера, когда клиент записывается к «Любому мастеру».
+type AssignRule string
+
+const (
+	// AssignLeastLoaded — мастер с наименьшим числом записей в этот день.
+	AssignLeastLoaded AssignRule = "least_loaded"
+	// AssignRoundRobin — мастер, которому дольше всех не назначали запись.
+	AssignRoundRobin AssignRule = "round_robin"
+)
+
+// rankMasters упорядочивает свободных мастеров по правилу rule: первый — кому назначить запись.
+// При равенстве выигрывает тот, кому дольше не назначали, затем меньший ID.
+func rankMasters(rule AssignRule, candidates []model.Master, loads []model.MasterLoad) []model.Master {
+	byID := make(map[int64]model.MasterLoad, len(loads))
+	for _, l := range loads {
+		byID[l.MasterID] = l
+	}
+	lastBooked := func(id int64) time.Time {
+		if at := byID[id].LastBookedAt; at != nil {
+			return *at
+		}
+		return time.Time{}
+	}
+
+	ranked := append([]model.Master(nil), candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i].ID, ranked[j].ID
+		if rule != AssignRoundRobin && byID[a].Appointments != byID[b].Appointments {
+			return byID[a].Appointments < byID[b].Appointments
+		}
+		if la, lb := lastBooked(a), lastBooked(b); !la.Equal(lb) {
+			return la.Before(lb)
+		}
+		return a < b
+	})
+	return ranked
+}
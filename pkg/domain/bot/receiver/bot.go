@@ -0,0 +1,148 @@
+package receiver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog"
+)
+
+// remindTTL — через сколько удаляется напоминание «используйте кнопки».
+const remindTTL = 5 * time.Second
+
+// HoldReleaser снимает удержание слота пользователя (обычно model.Repo).
+type HoldReleaser interface {
+	ReleaseHold(ctx context.Context, tgUserID int64) error
+}
+
+// Bot обрабатывает апдейт целиком: загружает сессию, команды и текст разбирает сам,
+// нажатия на кнопки отдаёт Router, затем сохраняет сессию. Повторно доставленные апдейты
+// отсекает Dedup.
+type Bot struct {
+	api      BotAPI
+	sessions SessionStore
+	router   *Router
+	codec    *Codec
+	dedup    *Dedup
+	holds    HoldReleaser
+	logger   zerolog.Logger
+}
+
+func NewBot(
+	api BotAPI,
+	sessions SessionStore,
+	router *Router,
+	codec *Codec,
+	dedup *Dedup,
+	holds HoldReleaser,
+	logger zerolog.Logger,
+) *Bot {
+	return &Bot{
+		api:      api,
+		sessions: sessions,
+		router:   router,
+		codec:    codec,
+		dedup:    dedup,
+		holds:    holds,
+		logger:   logger,
+	}
+}
+
+// HandleUpdate подходит как UpdateHandler для Dispatcher.
+func (b *Bot) HandleUpdate(ctx context.Context, update tgbotapi.Update) {
+	from := update.SentFrom()
+	if from == nil {
+		return
+	}
+	if b.dedup.Seen(ctx, update) {
+		b.logger.Debug().Int("update", update.UpdateID).Msg("duplicate update skipped")
+		return
+	}
+	sess, err := b.sessions.Load(ctx, from.ID)
+	if err != nil {
+		b.logger.Error().Err(err).Int64("user", from.ID).Msg("load session")
+		return
+	}
+	onConfirm := sess.State == StateBookConfirm
+
+	var handleErr error
+	switch {
+	case update.Message != nil:
+		b.handleMessage(ctx, update.Message, sess)
+	case update.CallbackQuery != nil:
+		// Нажатия на inline-кнопки; ошибки уже залогированы middleware
+		handleErr = b.router.Dispatch(NewContext(ctx, b.api, update.CallbackQuery, sess, b.logger))
+	default:
+		return
+	}
+
+	// Удержание живёт, пока клиент на экране подтверждения. Уйти с него можно кнопкой,
+	// командой /start или сбросом по устаревшей кнопке (VerifyCallback) — снимаем в любом случае.
+	// Брошенные удержания истекают сами.
+	if onConfirm && sess.State != StateBookConfirm {
+		if err := b.holds.ReleaseHold(ctx, from.ID); err != nil {
+			b.logger.Warn().Err(err).Int64("user", from.ID).Msg("release slot hold")
+		}
+	}
+
+	if err := b.sessions.Save(ctx, sess); err != nil {
+		b.logger.Error().Err(err).Int64("user", from.ID).Msg("save session")
+		return
+	}
+	if handleErr == nil {
+		b.dedup.Done(ctx, update)
+	}
+}
+
+func (b *Bot) handleMessage(ctx context.Context, m *tgbotapi.Message, sess *Session) {
+	// если это /start — показываем приветствие
+	if m.IsCommand() && m.Command() == "start" {
+		b.handleStartCommand(ctx, m, sess)
+		return
+	}
+
+	// Любой произвольный текст — удаляем (если возможно) и напоминаем
+	_, _ = b.api.Request(ctx, tgbotapi.NewDeleteMessage(m.Chat.ID, m.MessageID))
+
+	remind := tgbotapi.NewMessage(m.Chat.ID, "Пожалуйста, используйте кнопки 👆")
+	sent, err := b.api.Send(ctx, remind)
+	if err != nil {
+		b.logger.Warn().Err(err).Int64("chat", m.Chat.ID).Msg("send buttons reminder")
+		return
+	}
+	go func(chatID int64, mid int) {
+		t := time.NewTimer(remindTTL)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		_, _ = b.api.Request(ctx, tgbotapi.NewDeleteMessage(chatID, mid))
+	}(m.Chat.ID, sent.MessageID)
+}
+
+func (b *Bot) handleStartCommand(ctx context.Context, m *tgbotapi.Message, sess *Session) {
+	sess.ResetFlow()
+	sess.State = StateStart
+	if _, err := b.api.Request(ctx, tgbotapi.NewDeleteMessage(m.Chat.ID, m.MessageID)); err != nil {
+		b.logger.Warn().Err(err).Msg("delete /start failed")
+	}
+	msg := tgbotapi.NewPhoto(m.Chat.ID, tgbotapi.FilePath("pictures/logo.png"))
+	msg.Caption = fmt.Sprintf("<b>Приветствую %s!\n"+
+		"Данный чат-бот поможет Вам записаться на услуги барбера. "+
+		"Здесь вы можете отслеживать свои записи и т.д.\n"+
+		"Для того, чтобы начать работу с нашим ботом нажмите НАЧАТЬ</b>😺", m.From.FirstName)
+	msg.ParseMode = "HTML"
+	markup := StartMenu()
+	if err := b.codec.SignMarkup(m.Chat.ID, &markup); err != nil {
+		b.logger.Error().Err(err).Msg("sign start menu")
+		return
+	}
+	msg.ReplyMarkup = markup
+	if _, err := b.api.Send(ctx, msg); err != nil {
+		b.logger.Printf("send start menu error: %v", err)
+	}
+}
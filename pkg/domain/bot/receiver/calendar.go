@@ -0,0 +1,125 @@
+package receiver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+)
+
+var (
+	weekdayNames = [...]string{"Вс", "Пн", "Вт", "Ср", "Чт", "Пт", "Сб"}
+	monthNames   = [...]string{
+		"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь",
+		"Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь",
+	}
+)
+
+// CalendarMenu — клавиатура-календарь на месяц month (неделя с понедельника).
+// Выбрать можно только дни из free; остальные перечёркнуты. prev/next — есть ли соседние страницы.
+func CalendarMenu(month time.Time, free map[int]bool, prev, next bool) tgbotapi.InlineKeyboardMarkup {
+	noop := func(label string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(label, CbNoop)
+	}
+	first := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		{noop(fmt.Sprintf("%s %d", monthNames[first.Month()-1], first.Year()))},
+	}
+	header := make([]tgbotapi.InlineKeyboardButton, 0, 7)
+	for i := range 7 {
+		header = append(header, noop(weekdayNames[(i+1)%7]))
+	}
+	rows = append(rows, header)
+
+	// Пустые клетки до первого числа: понедельник — 0
+	offset := (int(first.Weekday()) + 6) % 7
+	cells := make([]tgbotapi.InlineKeyboardButton, 0, 42)
+	for range offset {
+		cells = append(cells, noop("·"))
+	}
+	for d := first; d.Month() == first.Month(); d = d.AddDate(0, 0, 1) {
+		label := strconv.Itoa(d.Day())
+		if free[d.Day()] {
+			cells = append(cells, tgbotapi.NewInlineKeyboardButtonData(label, PD+d.Format("2006-01-02")))
+		} else {
+			cells = append(cells, tgbotapi.NewInlineKeyboardButtonData(strikethrough(label), CbNoFree))
+		}
+	}
+	for len(cells)%7 != 0 {
+		cells = append(cells, noop("·"))
+	}
+	rows = append(rows, grid(cells, 7)...)
+
+	nav := make([]tgbotapi.InlineKeyboardButton, 0, 2)
+	if prev {
+		prevMonth := first.AddDate(0, -1, 0).Format("2006-01")
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("◀️", PCal+prevMonth))
+	}
+	if next {
+		nextMonth := first.AddDate(0, 1, 0).Format("2006-01")
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("▶️", PCal+nextMonth))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+	return withBack(rows)
+}
+
+// strikethrough перечёркивает текст комбинируемым символом U+0336 — так в кнопке видно, что день недоступен.
+func strikethrough(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteRune(r)
+		b.WriteRune('̶')
+	}
+	return b.String()
+}
+
+// renderDate показывает календарь на месяц из сессии (по умолчанию текущий), отмечая дни
+// со свободным временем у выбранного мастера.
+func (r *Renderer) renderDate(ctx context.Context, sess *Session) (Screen, error) {
+	loc := r.zone(sess.Booking)
+	first, last := r.policy.Horizon(time.Now(), loc)
+	firstMonth := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, loc)
+	lastMonth := time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, loc)
+
+	month := firstMonth
+	if sess.Booking.Month != "" {
+		m, err := time.ParseInLocation("2006-01", sess.Booking.Month, loc)
+		if err != nil {
+			return Screen{}, errs.New("invalid calendar month").Arg("month", sess.Booking.Month).Wrap(err)
+		}
+		month = m
+	}
+	if month.Before(firstMonth) {
+		month = firstMonth
+	}
+	if month.After(lastMonth) {
+		month = lastMonth
+	}
+
+	start, end := month, month.AddDate(0, 1, -1)
+	if start.Before(first) {
+		start = first
+	}
+	if end.After(last) {
+		end = last
+	}
+	days, err := r.freeDays(ctx, sess, start, end)
+	if err != nil {
+		return Screen{}, errs.New("failed to list free days").Arg("month", month.Format("2006-01")).Wrap(err)
+	}
+	free := make(map[int]bool, len(days))
+	for _, d := range days {
+		free[d.Day()] = true
+	}
+
+	text := "Выберите дату:\nПеречёркнуты дни без свободного времени."
+	keyboard := CalendarMenu(month, free, month.After(firstMonth), month.Before(lastMonth))
+	return Screen{Text: text, Keyboard: keyboard}, nil
+}
@@ -0,0 +1,237 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/napryag/tg_services_bot/pkg/repository/model"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+)
+
+// FindLocation возвращает активный филиал по ID или nil, если такого нет.
+func FindLocation(ctx context.Context, repo model.Repo, locationID int64) (*model.Location, error) {
+	locations, err := repo.ListActiveLocations(ctx)
+	if err != nil {
+		return nil, errs.New("failed to list locations").Wrap(err)
+	}
+	for i := range locations {
+		if locations[i].ID == locationID {
+			return &locations[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ActiveMasters — активные мастера филиала locationID (0 — всех филиалов).
+func ActiveMasters(ctx context.Context, repo model.Repo, locationID int64) ([]model.Master, error) {
+	masters, err := repo.ListActiveMasters(ctx)
+	if err != nil {
+		return nil, errs.New("failed to list masters").Wrap(err)
+	}
+	if locationID == 0 {
+		return masters, nil
+	}
+	out := masters[:0]
+	for _, m := range masters {
+		if m.LocationID == locationID {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// FindMaster возвращает активного мастера филиала locationID по ID или nil, если такого нет.
+func FindMaster(ctx context.Context, repo model.Repo, locationID, masterID int64) (*model.Master, error) {
+	masters, err := ActiveMasters(ctx, repo, locationID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range masters {
+		if masters[i].ID == masterID {
+			return &masters[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// FindService возвращает услугу, только если её оказывает выбранный мастер, иначе nil.
+func FindService(ctx context.Context, repo model.Repo, masterID, serviceID int64) (*model.Service, error) {
+	services, err := repo.ListServicesByMaster(ctx, masterID)
+	if err != nil {
+		return nil, errs.New("failed to list services").Arg("master", masterID).Wrap(err)
+	}
+	for i := range services {
+		if services[i].ID == serviceID {
+			return &services[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// AnyMasterServices — услуги, которые оказывает хотя бы один активный мастер филиала locationID.
+func AnyMasterServices(ctx context.Context, repo model.Repo, locationID int64) ([]model.Service, error) {
+	masters, err := ActiveMasters(ctx, repo, locationID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]bool)
+	var out []model.Service
+	for _, m := range masters {
+		services, err := repo.ListServicesByMaster(ctx, m.ID)
+		if err != nil {
+			return nil, errs.New("failed to list services").Arg("master", m.ID).Wrap(err)
+		}
+		for _, svc := range services {
+			if !seen[svc.ID] {
+				seen[svc.ID] = true
+				out = append(out, svc)
+			}
+		}
+	}
+	return out, nil
+}
+
+// FindAnyService возвращает услугу, если её оказывает хотя бы один активный мастер филиала
+// locationID, иначе nil.
+func FindAnyService(ctx context.Context, repo model.Repo, locationID, serviceID int64) (*model.Service, error) {
+	services, err := AnyMasterServices(ctx, repo, locationID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range services {
+		if services[i].ID == serviceID {
+			return &services[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// MastersForService — активные мастера филиала locationID, оказывающие услугу serviceID.
+func MastersForService(ctx context.Context, repo model.Repo, locationID, serviceID int64) ([]model.Master, error) {
+	masters, err := ActiveMasters(ctx, repo, locationID)
+	if err != nil {
+		return nil, err
+	}
+	var out []model.Master
+	for _, m := range masters {
+		svc, err := FindService(ctx, repo, m.ID, serviceID)
+		if err != nil {
+			return nil, err
+		}
+		if svc != nil {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// AnyMasterSlots объединяет свободное время всех мастеров филиала locationID, оказывающих услугу
+// q.ServiceID (q.MasterID не используется). Время, свободное у нескольких мастеров, показывается один раз.
+func AnyMasterSlots(ctx context.Context, repo model.Repo, locationID int64, q model.SlotQuery) ([]model.Slot, error) {
+	masters, err := MastersForService(ctx, repo, locationID, q.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[time.Time]bool)
+	var out []model.Slot
+	for _, m := range masters {
+		q.MasterID = m.ID
+		slots, err := repo.ListAvailableSlots(ctx, q)
+		if err != nil {
+			return nil, errs.New("failed to list slots").Arg("master", m.ID).Wrap(err)
+		}
+		for _, sl := range slots {
+			if key := sl.StartLocal.UTC(); !seen[key] {
+				seen[key] = true
+				out = append(out, sl)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartLocal.Before(out[j].StartLocal) })
+	return out, nil
+}
+
+// AnyMasterFreeDays объединяет дни со свободным временем с q.Day по last у всех мастеров филиала
+// locationID, оказывающих услугу q.ServiceID; дни — по возрастанию.
+func AnyMasterFreeDays(
+	ctx context.Context,
+	repo model.Repo,
+	locationID int64,
+	q model.SlotQuery,
+	last time.Time,
+) ([]time.Time, error) {
+	masters, err := MastersForService(ctx, repo, locationID, q.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[time.Time]bool)
+	var out []time.Time
+	for _, m := range masters {
+		q.MasterID = m.ID
+		days, err := repo.ListFreeDays(ctx, q, last)
+		if err != nil {
+			return nil, errs.New("failed to list free days").Arg("master", m.ID).Wrap(err)
+		}
+		for _, d := range days {
+			if key := d.UTC(); !seen[key] {
+				seen[key] = true
+				out = append(out, d)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out, nil
+}
+
+// FreeMastersAt — мастера филиала locationID, у которых на день q.Day свободно время с началом start.
+func FreeMastersAt(
+	ctx context.Context,
+	repo model.Repo,
+	locationID int64,
+	q model.SlotQuery,
+	start time.Time,
+) ([]model.Master, error) {
+	masters, err := MastersForService(ctx, repo, locationID, q.ServiceID)
+	if err != nil {
+		return nil, err
+	}
+	var out []model.Master
+	for _, m := range masters {
+		q.MasterID = m.ID
+		slots, err := repo.ListAvailableSlots(ctx, q)
+		if err != nil {
+			return nil, errs.New("failed to list slots").Arg("master", m.ID).Wrap(err)
+		}
+		for _, sl := range slots {
+			if sl.StartLocal.Equal(start) {
+				out = append(out, m)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// OwnAppointment возвращает запись, только если она принадлежит Telegram-пользователю tgUserID.
+func OwnAppointment(ctx context.Context, repo model.Repo, tgUserID, id int64) (*model.AppointmentDetails, error) {
+	u, err := repo.GetUserByTG(ctx, tgUserID)
+	if err != nil {
+		return nil, errs.New("failed to get user").Wrap(err)
+	}
+	if u == nil {
+		return nil, model.ErrNotFound
+	}
+	a, err := repo.GetAppointmentDetails(ctx, id)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, err
+		}
+		return nil, errs.New("failed to get appointment").Arg("id", id).Wrap(err)
+	}
+	if a.UserID != u.ID {
+		return nil, model.ErrNotFound
+	}
+	return a, nil
+}
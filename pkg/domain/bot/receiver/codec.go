@@ -0,0 +1,149 @@
+package receiver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+)
+
+// MaxCallbackData — лимит Telegram на callback_data в байтах.
+const MaxCallbackData = 64
+
+// codecVersion — первый символ подписанной callback data; при смене формата увеличить.
+const codecVersion = "1"
+
+const (
+	codecSep     = "|"
+	codecSigSize = 9 // байт HMAC в подписи (12 символов base64url)
+)
+
+var (
+	// ErrCallbackForged — подпись не сходится: данные подделаны или кнопка из другого чата.
+	ErrCallbackForged = errors.New("callback_forged")
+	// ErrCallbackExpired — срок жизни кнопки истёк.
+	ErrCallbackExpired = errors.New("callback_expired")
+	// ErrCallbackVersion — кнопка в старом или неизвестном формате.
+	ErrCallbackVersion = errors.New("callback_version")
+	// ErrCallbackTooLong — подписанные данные не влезают в MaxCallbackData.
+	ErrCallbackTooLong = errors.New("callback_too_long")
+)
+
+// Codec подписывает callback data кнопок HMAC-ом с привязкой к чату и сроком жизни.
+// В личке chat ID совпадает с Telegram user ID, для staff-канала это ID канала.
+// Формат: <версия><данные>|<срок, unix base36>|<подпись base64url>, например
+// "1d:2025-08-20|t0kq2o|Xq3...".
+type Codec struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewCodec(secret string, ttl time.Duration) *Codec {
+	return &Codec{secret: []byte(secret), ttl: ttl, now: time.Now}
+}
+
+// WithTTL возвращает кодек с тем же ключом и другим сроком жизни кнопок.
+func (c *Codec) WithTTL(ttl time.Duration) *Codec {
+	cp := *c
+	cp.ttl = ttl
+	return &cp
+}
+
+// Encode подписывает data для кнопки в чате chatID.
+func (c *Codec) Encode(chatID int64, data string) (string, error) {
+	exp := strconv.FormatInt(c.now().Add(c.ttl).Unix(), 36)
+	body := codecVersion + data + codecSep + exp
+	out := body + codecSep + c.sign(chatID, body)
+	if len(out) > MaxCallbackData {
+		return "", errs.New("callback data too long").Arg("data", data).Wrap(ErrCallbackTooLong)
+	}
+	return out, nil
+}
+
+// Decode проверяет версию, подпись и срок и возвращает исходные данные.
+func (c *Codec) Decode(chatID int64, raw string) (string, error) {
+	if !strings.HasPrefix(raw, codecVersion) {
+		return "", ErrCallbackVersion
+	}
+	i := strings.LastIndex(raw, codecSep)
+	if i < 0 {
+		return "", ErrCallbackForged
+	}
+	body, sig := raw[:i], raw[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(c.sign(chatID, body))) {
+		return "", ErrCallbackForged
+	}
+
+	j := strings.LastIndex(body, codecSep)
+	if j < 0 {
+		return "", ErrCallbackForged
+	}
+	exp, err := strconv.ParseInt(body[j+1:], 36, 64)
+	if err != nil {
+		return "", ErrCallbackForged
+	}
+	if c.now().Unix() > exp {
+		return "", ErrCallbackExpired
+	}
+	return body[len(codecVersion):j], nil
+}
+
+// SignMarkup подписывает callback data всех кнопок клавиатуры.
+func (c *Codec) SignMarkup(chatID int64, markup *tgbotapi.InlineKeyboardMarkup) error {
+	for _, row := range markup.InlineKeyboard {
+		for i := range row {
+			if row[i].CallbackData == nil {
+				continue
+			}
+			signed, err := c.Encode(chatID, *row[i].CallbackData)
+			if err != nil {
+				return err
+			}
+			row[i].CallbackData = &signed
+		}
+	}
+	return nil
+}
+
+func (c *Codec) sign(chatID int64, body string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(strconv.FormatInt(chatID, 10)))
+	mac.Write([]byte(codecSep))
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:codecSigSize])
+}
+
+// VerifyCallback расшифровывает callback data до выбора маршрута. Просроченная или поддельная
+// кнопка не ломает диалог: пользователь видит пояснение и возвращается в главное меню.
+func VerifyCallback(codec *Codec) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			data, err := codec.Decode(c.Query.Message.Chat.ID, c.Query.Data)
+			if err != nil {
+				c.Logger.Warn().Err(err).Int64("user", c.Session.UserID).Str("data", c.Query.Data).
+					Msg("callback rejected")
+				if errors.Is(err, ErrCallbackForged) {
+					c.Alert("Эта кнопка недействительна. Возвращаем вас в главное меню.")
+				} else {
+					c.Alert("Эта кнопка устарела. Возвращаем вас в главное меню.")
+				}
+				if !c.Query.Message.Chat.IsPrivate() {
+					// В staff-канале не рисуем клиентские экраны
+					c.SkipRender()
+					return nil
+				}
+				c.Session.ResetFlow()
+				return nil
+			}
+			c.Query.Data = data
+			return next(c)
+		}
+	}
+}
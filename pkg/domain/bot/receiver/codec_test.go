@@ -0,0 +1,118 @@
+package receiver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCodec(now time.Time) *Codec {
+	c := NewCodec("test-secret", time.Hour)
+	c.now = func() time.Time { return now }
+	return c
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	c := testCodec(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+	for _, data := range []string{CbMain, PD + "2026-10-20", PNoShow + "123456789", ""} {
+		raw, err := c.Encode(42, data)
+		if err != nil {
+			t.Fatalf("encode %q: %v", data, err)
+		}
+		got, err := c.Decode(42, raw)
+		if err != nil {
+			t.Fatalf("decode %q: %v", raw, err)
+		}
+		if got != data {
+			t.Fatalf("decode = %q, want %q", got, data)
+		}
+	}
+}
+
+func TestCodecRejects(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	c := testCodec(now)
+	raw, err := c.Encode(42, PD+"2026-10-20")
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	i := strings.LastIndex(raw, codecSep)
+	body, sig := raw[:i], raw[i+1:]
+	flip := func(s string, at int) string {
+		b := []byte(s)
+		if b[at] == 'A' {
+			b[at] = 'B'
+		} else {
+			b[at] = 'A'
+		}
+		return string(b)
+	}
+
+	tests := []struct {
+		name   string
+		codec  *Codec
+		chatID int64
+		raw    string
+		want   error
+	}{
+		{"изменены данные", c, 42, strings.Replace(raw, "2026-10-20", "2026-10-21", 1), ErrCallbackForged},
+		{"изменена подпись", c, 42, body + codecSep + flip(sig, 0), ErrCallbackForged},
+		{"подпись обрезана", c, 42, body + codecSep + sig[:len(sig)-1], ErrCallbackForged},
+		{"без подписи", c, 42, body, ErrCallbackForged},
+		{"продлён срок", c, 42, strings.Replace(raw, codecSep, codecSep+"z", 1), ErrCallbackForged},
+		{"другой чат", c, 43, raw, ErrCallbackForged},
+		{"другой ключ", NewCodec("other-secret", time.Hour), 42, raw, ErrCallbackForged},
+		{"срок истёк", testCodec(now.Add(time.Hour + time.Second)), 42, raw, ErrCallbackExpired},
+		{"неизвестная версия", c, 42, "2" + raw[len(codecVersion):], ErrCallbackVersion},
+		{"без подписи и версии", c, 42, CbMain, ErrCallbackVersion},
+		{"пустые данные", c, 42, "", ErrCallbackVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.codec.Decode(tt.chatID, tt.raw)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("decode %q: data = %q, err = %v, want %v", tt.raw, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodecExpiresAtTTL(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	raw, err := testCodec(now).Encode(42, CbMain)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if _, err := testCodec(now.Add(time.Hour)).Decode(42, raw); err != nil {
+		t.Fatalf("decode at ttl: %v", err)
+	}
+	if _, err := testCodec(now.Add(time.Hour+time.Second)).Decode(42, raw); !errors.Is(err, ErrCallbackExpired) {
+		t.Fatalf("decode after ttl: err = %v, want ErrCallbackExpired", err)
+	}
+}
+
+func TestCodecCallbackDataLimit(t *testing.T) {
+	c := testCodec(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+	// версия, два разделителя, срок и подпись занимают фиксированное место
+	raw, err := c.Encode(-1001234567890, "")
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	room := MaxCallbackData - len(raw)
+
+	fits, err := c.Encode(-1001234567890, strings.Repeat("x", room))
+	if err != nil {
+		t.Fatalf("encode %d bytes: %v", room, err)
+	}
+	if len(fits) != MaxCallbackData {
+		t.Fatalf("len = %d, want %d", len(fits), MaxCallbackData)
+	}
+	if _, err := c.Encode(-1001234567890, strings.Repeat("x", room+1)); !errors.Is(err, ErrCallbackTooLong) {
+		t.Fatalf("encode %d bytes: err = %v, want ErrCallbackTooLong", room+1, err)
+	}
+	// самая длинная кнопка бота — неявка по большому id в staff-канале
+	if _, err := c.WithTTL(60*24*time.Hour).Encode(-1001234567890, PNoShow+"9223372036854775807"); err != nil {
+		t.Fatalf("encode no-show: %v", err)
+	}
+}
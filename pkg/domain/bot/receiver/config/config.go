@@ -1,8 +1,10 @@
 package config
 
 import (
+	"net/url"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
@@ -10,12 +12,84 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// Хранилища FSM-сессий.
+const (
+	SessionStorePostgres = "postgres"
+	SessionStoreMemory   = "memory"
+)
+
+// Правила выбора мастера для записи к «Любому мастеру».
+const (
+	AssignLeastLoaded = "least_loaded"
+	AssignRoundRobin  = "round_robin"
+)
+
+// Способы получения апдейтов.
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+const (
+	defaultCallbackTTL = 24 * time.Hour
+	defaultSlotHoldTTL = 10 * time.Minute
+	defaultHorizonDays = 30
+	defaultSlotGrid    = 15 * time.Minute
+	defaultMinLead     = time.Hour
+	defaultDeadline    = 2 * time.Hour
+)
+
 type Config struct {
 	PostgreAddr string `yaml:"postgreAddr" validate:"required"`
-	// WebhookURL  string `yaml:"webhookUrl" validate:"required"`
-	HTTPPort    int `yaml:"httpPort" validate:"required"`
-	WorkerCount int `yaml:"workerCount" validate:"required"`
-	BotToken    string
+	// Mode: polling (по умолчанию) или webhook — тогда HTTP-сервер слушает httpPort
+	Mode        string `yaml:"mode" validate:"omitempty,oneof=polling webhook"`
+	WebhookURL  string `yaml:"webhookUrl" validate:"required_if=Mode webhook,omitempty,url"`
+	HTTPPort    int    `yaml:"httpPort" validate:"required"`
+	WorkerCount int    `yaml:"workerCount" validate:"required"`
+	// SessionStore: postgres (по умолчанию) или memory — сессии теряются при рестарте
+	SessionStore string `yaml:"sessionStore" validate:"omitempty,oneof=postgres memory"`
+	// Timezone — часовой пояс салона в формате IANA (например, Europe/Moscow) на случай, если у филиала
+	// он неизвестен: время записей считается в поясе филиала, независимо от пояса сервера и базы
+	Timezone string `yaml:"timezone" validate:"required"`
+	// Location — загруженный Timezone
+	Location *time.Location `yaml:"-"`
+	// CallbackTTL — срок жизни подписанных inline-кнопок (по умолчанию 24h)
+	CallbackTTL time.Duration `yaml:"callbackTtl" validate:"omitempty,min=1m"`
+	// SlotHoldTTL — сколько выбранное время держится за клиентом на экране подтверждения (по умолчанию 10m)
+	SlotHoldTTL time.Duration `yaml:"slotHoldTtl" validate:"omitempty,min=1m"`
+	// SlotGrid — шаг, с которым может начинаться запись (по умолчанию 15m), независимо от длительности услуги
+	SlotGrid time.Duration `yaml:"slotGrid" validate:"omitempty,min=5m"`
+	// MinBookingLead — не раньше чем за сколько до начала можно записаться (по умолчанию 1h)
+	MinBookingLead time.Duration `yaml:"minBookingLead" validate:"omitempty,min=1m"`
+	// ChangeDeadline — не позже чем за сколько до начала можно отменить или перенести запись (по умолчанию 2h)
+	ChangeDeadline time.Duration `yaml:"changeDeadline" validate:"omitempty,min=1m"`
+	// BookingHorizonDays — на сколько дней вперёд (включая сегодня) можно записаться (по умолчанию 30)
+	BookingHorizonDays int `yaml:"bookingHorizonDays" validate:"omitempty,min=1,max=366"`
+	// MasterAssignment: least_loaded (по умолчанию) или round_robin
+	MasterAssignment string `yaml:"masterAssignment" validate:"omitempty,oneof=least_loaded round_robin"`
+	// ReminderLeads — за сколько до начала записи напоминать клиенту (например, 24h и 2h)
+	ReminderLeads []time.Duration `yaml:"reminderLeads" validate:"dive,min=1m"`
+	BotToken      string
+	// WebhookSecret сверяется с заголовком X-Telegram-Bot-Api-Secret-Token
+	WebhookSecret string
+	// CallbackSecret — ключ HMAC для подписи callback data
+	CallbackSecret string
+
+	PostgresUser     string
+	PostgresPassword string
+	PostgresDB       string
+}
+
+// DSN собирает строку подключения к Postgres из адреса в app.yml и учётных данных из .env.
+func (c *Config) DSN() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.PostgresUser, c.PostgresPassword),
+		Host:     c.PostgreAddr,
+		Path:     c.PostgresDB,
+		RawQuery: "sslmode=disable",
+	}
+	return u.String()
 }
 
 func LoadConfig() (*Config, error) {
@@ -34,11 +108,49 @@ func LoadConfig() (*Config, error) {
 	if err = validator.New().Struct(cfg); err != nil {
 		return nil, errs.New("config validation failed").Wrap(err)
 	}
+	if cfg.Location, err = time.LoadLocation(cfg.Timezone); err != nil {
+		return nil, errs.New("invalid timezone").Arg("timezone", cfg.Timezone).Wrap(err)
+	}
 
 	if err = godotenv.Load(); err != nil {
 		return nil, errs.New("failed to load .env").Wrap(err)
 	}
 	cfg.BotToken = os.Getenv("TG_TOKEN")
+	cfg.CallbackSecret = os.Getenv("TG_CALLBACK_SECRET")
+	if cfg.CallbackSecret == "" {
+		return nil, errs.New("empty callback secret")
+	}
+	if cfg.CallbackTTL == 0 {
+		cfg.CallbackTTL = defaultCallbackTTL
+	}
+	if cfg.SlotHoldTTL == 0 {
+		cfg.SlotHoldTTL = defaultSlotHoldTTL
+	}
+	if cfg.SlotGrid == 0 {
+		cfg.SlotGrid = defaultSlotGrid
+	}
+	if cfg.MinBookingLead == 0 {
+		cfg.MinBookingLead = defaultMinLead
+	}
+	if cfg.ChangeDeadline == 0 {
+		cfg.ChangeDeadline = defaultDeadline
+	}
+	if cfg.BookingHorizonDays == 0 {
+		cfg.BookingHorizonDays = defaultHorizonDays
+	}
+	if cfg.MasterAssignment == "" {
+		cfg.MasterAssignment = AssignLeastLoaded
+	}
+	cfg.WebhookSecret = os.Getenv("TG_WEBHOOK_SECRET")
+	if cfg.Mode == ModeWebhook && cfg.WebhookSecret == "" {
+		return nil, errs.New("empty webhook secret")
+	}
+	cfg.PostgresUser = os.Getenv("POSTGRES_USER")
+	cfg.PostgresPassword = os.Getenv("POSTGRES_PASSWORD")
+	cfg.PostgresDB = os.Getenv("POSTGRES_DB")
+	if cfg.PostgresDB == "" {
+		return nil, errs.New("empty postgres db name")
+	}
 
 	return &cfg, nil
 }
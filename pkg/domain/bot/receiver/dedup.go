@@ -0,0 +1,76 @@
+package receiver
+
+import (
+	"context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog"
+)
+
+// UpdateLog — журнал обработанных апдейтов (обычно model.Repo).
+type UpdateLog interface {
+	UpdateProcessed(ctx context.Context, updateID int, callbackID string) (bool, error)
+	SaveProcessedUpdate(ctx context.Context, updateID int, callbackID string) error
+	PurgeUpdates(ctx context.Context, before time.Time) error
+}
+
+const (
+	// dedupRetention — сколько помнить апдейты: Telegram повторяет доставку не дольше суток.
+	dedupRetention = 48 * time.Hour
+	// dedupPurgeInterval — как часто чистить журнал.
+	dedupPurgeInterval = time.Hour
+)
+
+// Dedup отсекает повторно доставленные апдейты: тот же update_id (повтор webhook или
+// getUpdates после рестарта) или тот же callback query.
+type Dedup struct {
+	log    UpdateLog
+	logger zerolog.Logger
+}
+
+func NewDedup(log UpdateLog, logger zerolog.Logger) *Dedup {
+	return &Dedup{log: log, logger: logger}
+}
+
+// Seen сообщает, обработан ли уже апдейт. Если журнал недоступен, апдейт обрабатывается:
+// лучше дубль, чем потерянное нажатие.
+func (d *Dedup) Seen(ctx context.Context, u tgbotapi.Update) bool {
+	seen, err := d.log.UpdateProcessed(ctx, u.UpdateID, callbackID(u))
+	if err != nil {
+		d.logger.Warn().Err(err).Int("update", u.UpdateID).Msg("check processed update")
+		return false
+	}
+	return seen
+}
+
+// Done отмечает апдейт обработанным. Вызывается только после успешной обработки: апдейт,
+// на котором бот упал или обработчик вернул ошибку, Telegram доставит повторно и он не отсеется.
+func (d *Dedup) Done(ctx context.Context, u tgbotapi.Update) {
+	if err := d.log.SaveProcessedUpdate(ctx, u.UpdateID, callbackID(u)); err != nil {
+		d.logger.Warn().Err(err).Int("update", u.UpdateID).Msg("save processed update")
+	}
+}
+
+func callbackID(u tgbotapi.Update) string {
+	if u.CallbackQuery != nil {
+		return u.CallbackQuery.ID
+	}
+	return ""
+}
+
+// Run чистит журнал до отмены ctx.
+func (d *Dedup) Run(ctx context.Context) {
+	ticker := time.NewTicker(dedupPurgeInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.log.PurgeUpdates(ctx, time.Now().Add(-dedupRetention)); err != nil {
+			d.logger.Error().Err(err).Msg("purge processed updates")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package receiver
+
+import (
+	"context"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// UpdateHandler обрабатывает один апдейт.
+type UpdateHandler func(ctx context.Context, update tgbotapi.Update)
+
+// Dispatcher раскладывает апдейты по воркерам по хешу user/chat ID: апдейты одного
+// пользователя обрабатываются строго по порядку одним воркером, разных — параллельно.
+// Поэтому сессию пользователя в каждый момент загружает и сохраняет только один воркер.
+type Dispatcher struct {
+	queues []chan tgbotapi.Update
+	handle UpdateHandler
+}
+
+// dispatcherQueueSize — буфер очереди каждого воркера.
+const dispatcherQueueSize = 64
+
+func NewDispatcher(workerCount int, handle UpdateHandler) *Dispatcher {
+	workerCount = max(workerCount, 1)
+	queues := make([]chan tgbotapi.Update, workerCount)
+	for i := range queues {
+		queues[i] = make(chan tgbotapi.Update, dispatcherQueueSize)
+	}
+	return &Dispatcher{queues: queues, handle: handle}
+}
+
+// Run читает апдейты, пока канал не закроется, и ждёт, пока воркеры дообработают очереди.
+// Отмена ctx не прерывает уже принятые апдейты: их обработка идёт без отмены.
+func (d *Dispatcher) Run(ctx context.Context, updates tgbotapi.UpdatesChannel) {
+	handleCtx := context.WithoutCancel(ctx)
+
+	var wg sync.WaitGroup
+	for _, q := range d.queues {
+		wg.Add(1)
+		go func(q <-chan tgbotapi.Update) {
+			defer wg.Done()
+			for update := range q {
+				d.handle(handleCtx, update)
+			}
+		}(q)
+	}
+
+	for update := range updates {
+		d.queues[d.shard(update)] <- update
+	}
+	for _, q := range d.queues {
+		close(q)
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) shard(update tgbotapi.Update) int {
+	var key int64
+	if from := update.SentFrom(); from != nil {
+		key = from.ID
+	} else if chat := update.FromChat(); chat != nil {
+		key = chat.ID
+	}
+	return int(uint64(key) % uint64(len(d.queues)))
+}
@@ -0,0 +1,119 @@
+package receiver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func messageFrom(userID int64, updateID int) tgbotapi.Update {
+	return tgbotapi.Update{
+		UpdateID: updateID,
+		Message: &tgbotapi.Message{
+			From: &tgbotapi.User{ID: userID},
+			Chat: &tgbotapi.Chat{ID: userID},
+		},
+	}
+}
+
+func TestDispatcherKeepsPerUserOrder(t *testing.T) {
+	const users, perUser = 10, 50
+
+	var mu sync.Mutex
+	got := map[int64][]int{}
+	handle := func(_ context.Context, u tgbotapi.Update) {
+		// разная задержка перемешала бы апдейты, если бы один пользователь попал к двум воркерам
+		time.Sleep(time.Duration(u.UpdateID%3) * 100 * time.Microsecond)
+		mu.Lock()
+		defer mu.Unlock()
+		id := u.SentFrom().ID
+		got[id] = append(got[id], u.UpdateID)
+	}
+
+	updates := make(chan tgbotapi.Update)
+	done := make(chan struct{})
+	go func() {
+		NewDispatcher(4, handle).Run(context.Background(), updates)
+		close(done)
+	}()
+	next := 0
+	for range perUser {
+		for u := range int64(users) {
+			updates <- messageFrom(u+1, next)
+			next++
+		}
+	}
+	close(updates)
+	<-done // Run возвращается только после обработки всех принятых апдейтов
+
+	if len(got) != users {
+		t.Fatalf("handled %d users, want %d", len(got), users)
+	}
+	for user, ids := range got {
+		if len(ids) != perUser {
+			t.Fatalf("user %d: handled %d updates, want %d", user, len(ids), perUser)
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Fatalf("user %d: update %d handled before %d", user, ids[i-1], ids[i])
+			}
+		}
+	}
+}
+
+func TestDispatcherRunsUsersInParallel(t *testing.T) {
+	d := NewDispatcher(2, nil)
+	// подбираем двух пользователей, попадающих к разным воркерам
+	first, second := messageFrom(1, 1), messageFrom(2, 2)
+	if d.shard(first) == d.shard(second) {
+		t.Fatalf("users 1 and 2 share worker %d", d.shard(first))
+	}
+
+	started := make(chan int64, 2)
+	release := make(chan struct{})
+	d.handle = func(_ context.Context, u tgbotapi.Update) {
+		started <- u.SentFrom().ID
+		<-release
+	}
+
+	updates := make(chan tgbotapi.Update, 2)
+	updates <- first
+	updates <- second
+	close(updates)
+	done := make(chan struct{})
+	go func() {
+		d.Run(context.Background(), updates)
+		close(done)
+	}()
+
+	// второй пользователь не ждёт, пока обработается первый
+	for range 2 {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("updates of different users are not handled in parallel")
+		}
+	}
+	close(release)
+	<-done
+}
+
+func TestDispatcherDoesNotCancelAcceptedUpdates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var handledErr error
+	d := NewDispatcher(1, func(hctx context.Context, _ tgbotapi.Update) {
+		cancel() // остановка бота во время обработки
+		handledErr = hctx.Err()
+	})
+
+	updates := make(chan tgbotapi.Update, 1)
+	updates <- messageFrom(1, 1)
+	close(updates)
+	d.Run(ctx, updates)
+	if handledErr != nil {
+		t.Fatalf("handler ctx canceled: %v", handledErr)
+	}
+}
@@ -1,12 +1,16 @@
 package receiver
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/repository/model"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
 )
 
 // ---------- FSM ----------
@@ -16,23 +20,76 @@ type State int
 const (
 	StateStart State = iota
 	StateMain
+	StateBookLocation
 	StateBookService
 	StateBookMaster
 	StateBookDate
 	StateBookTime
 	StateBookConfirm
 	StateMy
+	StateMyDetails
 	StateHelp
 )
 
+var stateNames = map[State]string{
+	StateStart:        "start",
+	StateMain:         "main",
+	StateBookLocation: "book_location",
+	StateBookService:  "book_service",
+	StateBookMaster:   "book_master",
+	StateBookDate:     "book_date",
+	StateBookTime:     "book_time",
+	StateBookConfirm:  "book_confirm",
+	StateMy:           "my",
+	StateMyDetails:    "my_details",
+	StateHelp:         "help",
+}
+
+// String возвращает имя состояния, под которым оно хранится в user_session.state.
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return "main"
+}
+
+// ParseState обратна String; неизвестное имя даёт StateMain.
+func ParseState(name string) State {
+	for st, n := range stateNames {
+		if n == name {
+			return st
+		}
+	}
+	return StateMain
+}
+
 type BookingData struct {
-	Service string
-	Master  string
-	Date    string // YYYY-MM-DD
-	Time    string // HH:MM
+	LocationID   int64  `json:"location_id,omitempty"`
+	LocationName string `json:"location_name,omitempty"`
+	Timezone     string `json:"timezone,omitempty"` // часовой пояс филиала: в нём Date и Time
+	MasterID     int64  `json:"master_id,omitempty"`
+	MasterName   string `json:"master_name,omitempty"`
+	// AnyMaster — клиенту неважно, к кому: MasterID назначается при выборе времени
+	AnyMaster   bool   `json:"any_master,omitempty"`
+	ServiceID   int64  `json:"service_id,omitempty"`
+	ServiceName string `json:"service_name,omitempty"`
+	Date        string `json:"date,omitempty"`  // YYYY-MM-DD
+	Time        string `json:"time,omitempty"`  // HH:MM
+	Month       string `json:"month,omitempty"` // YYYY-MM, страница календаря
+	// ConfirmKey — ключ идемпотентности кнопки «Подтвердить», новый при каждом выборе времени
+	ConfirmKey string `json:"confirm_key,omitempty"`
+
+	AppointmentID int64 `json:"appointment_id,omitempty"` // запись, открытая в «Мои записи»
+	// RescheduleID — переносимая запись: выбор даты и времени переносит её, а не создаёт новую
+	RescheduleID int64 `json:"reschedule_id,omitempty"`
+}
+
+func (b *BookingData) setLocation(l model.Location) {
+	b.LocationID, b.LocationName, b.Timezone = l.ID, l.Name, l.Timezone
 }
 
 type Session struct {
+	UserID  int64 // Telegram user ID владельца сессии
 	State   State
 	history []State
 	Booking BookingData
@@ -52,34 +109,18 @@ func (s *Session) Back() {
 	}
 }
 
+func (s *Session) clone() *Session {
+	c := *s
+	c.history = append([]State(nil), s.history...)
+	return &c
+}
+
 func (s *Session) ResetFlow() {
 	s.State = StateMain
 	s.history = s.history[:0]
 	s.Booking = BookingData{}
 }
 
-// ---------- Session store (in-memory, потокобезопасно) ----------
-
-type Store struct {
-	mu sync.RWMutex
-	m  map[int64]*Session
-}
-
-func NewStore() *Store {
-	return &Store{m: make(map[int64]*Session)}
-}
-
-func (s *Store) Get(userID int64) *Session {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if sess, ok := s.m[userID]; ok {
-		return sess
-	}
-	se := &Session{State: StateMain}
-	s.m[userID] = se
-	return se
-}
-
 // ---------- Callback keys ----------.
 
 const (
@@ -89,12 +130,24 @@ const (
 	CbMy    = "my"
 	CbHelp  = "help"
 	CbBack  = "back"
-	CbOk    = "confirm"
+	// CbAnyMaster — «Любой мастер»: мастер назначается при выборе времени
+	CbAnyMaster = "anymaster"
+	// Кнопки без действия: заголовки календаря и дни без свободного времени
+	CbNoop   = "noop"
+	CbNoFree = "nofree"
 
-	PSvc = "svc:" // svc:haircut
-	PM   = "m:"   // m:john
+	PL   = "loc:" // loc:2 (location.id)
+	PSvc = "svc:" // svc:12 (service.id)
+	PM   = "m:"   // m:3 (master.id)
 	PD   = "d:"   // d:2025-08-20
+	PCal = "cal:" // cal:2025-09 — месяц в календаре выбора даты
 	PT   = "t:"   // t:10:30
+	POk  = "ok:"  // ok:<ключ идемпотентности> — подтверждение записи
+	PA   = "a:"   // a:42 (appointment.id) — карточка записи
+	PX   = "x:"   // x:42 — отмена записи
+	PR   = "r:"   // r:42 — перенос записи
+
+	PNoShow = "ns:" // ns:42 — неявка, кнопка на посте в staff-канале
 )
 
 func Is(k, prefix string) (string, bool) {
@@ -119,128 +172,333 @@ func MainMenu() tgbotapi.InlineKeyboardMarkup {
 	)
 }
 
-func ServiceMenu() tgbotapi.InlineKeyboardMarkup {
-	return tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Стрижка", PSvc+"haircut"),
-			tgbotapi.NewInlineKeyboardButtonData("Бритьё", PSvc+"shave"),
-		),
-		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", CbBack)),
-	)
+func LocationMenu(locations []model.Location) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(locations))
+	for _, l := range locations {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(l.Name, PL+strconv.FormatInt(l.ID, 10)),
+		))
+	}
+	return withBack(rows)
 }
 
-func MastersMenu() tgbotapi.InlineKeyboardMarkup {
-	// заглушка: подставьте ваших мастеров
-	return tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Андрей", PM+"andrey"),
-			tgbotapi.NewInlineKeyboardButtonData("Мария", PM+"maria"),
-		),
-		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", CbBack)),
-	)
+func ServiceMenu(services []model.Service) tgbotapi.InlineKeyboardMarkup {
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(services))
+	for _, svc := range services {
+		data := PSvc + strconv.FormatInt(svc.ID, 10)
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(svc.Name, data))
+	}
+	return withBack(grid(buttons, 2))
 }
 
-func DateMenu() tgbotapi.InlineKeyboardMarkup {
-	now := time.Now()
-	d1 := now.AddDate(0, 0, 0).Format("2006-01-02")
-	d2 := now.AddDate(0, 0, 1).Format("2006-01-02")
-	d3 := now.AddDate(0, 0, 2).Format("2006-01-02")
-	return tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(HumanDate(d1), PD+d1),
-			tgbotapi.NewInlineKeyboardButtonData(HumanDate(d2), PD+d2),
-			tgbotapi.NewInlineKeyboardButtonData(HumanDate(d3), PD+d3),
-		),
-		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", CbBack)),
-	)
+func MastersMenu(masters []model.Master) tgbotapi.InlineKeyboardMarkup {
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(masters))
+	for _, m := range masters {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(m.Name, PM+strconv.FormatInt(m.ID, 10)))
+	}
+	rows := grid(buttons, 2)
+	if len(masters) > 1 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🎲 Любой мастер", CbAnyMaster),
+		))
+	}
+	return withBack(rows)
 }
 
-func TimeMenu() tgbotapi.InlineKeyboardMarkup {
-	// заглушка; можно генерировать по расписанию
-	slots := []string{"10:00", "12:00", "14:00", "16:00"}
-	row := make([]tgbotapi.InlineKeyboardButton, 0, len(slots))
-	for _, t := range slots {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData(t, PT+t))
+func TimeMenu(slots []model.Slot) tgbotapi.InlineKeyboardMarkup {
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(slots))
+	for _, sl := range slots {
+		t := sl.StartLocal.Format("15:04")
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(t, PT+t))
 	}
-	return tgbotapi.NewInlineKeyboardMarkup(
-		row,
-		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", CbBack)),
-	)
+	return withBack(grid(buttons, 4))
 }
 
-func ConfirmMenu() tgbotapi.InlineKeyboardMarkup {
+// NoSlotsMenu — пустое состояние выбора времени: переход на ближайшую дату со свободными слотами.
+func NoSlotsMenu(nextDate string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if nextDate != "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➡️ Ближайшая дата: "+HumanDate(nextDate), PD+nextDate),
+		))
+	}
+	return withBack(rows)
+}
+
+func ConfirmMenu(key string) tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", CbOk)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ Подтвердить", POk+key)),
 		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", CbBack)),
 	)
 }
 
+// grid раскладывает кнопки по рядам не более perRow в каждом.
+func grid(buttons []tgbotapi.InlineKeyboardButton, perRow int) [][]tgbotapi.InlineKeyboardButton {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, (len(buttons)+perRow-1)/perRow)
+	for len(buttons) > 0 {
+		n := min(perRow, len(buttons))
+		rows = append(rows, buttons[:n])
+		buttons = buttons[n:]
+	}
+	return rows
+}
+
+func withBack(rows [][]tgbotapi.InlineKeyboardButton) tgbotapi.InlineKeyboardMarkup {
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", CbBack)))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// MyMenu — записи клиента; время каждой — в часовом поясе её филиала (loc — если он неизвестен).
+func MyMenu(items []model.AppointmentDetails, loc *time.Location) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(items))
+	for _, a := range items {
+		label := fmt.Sprintf("%s · %s", a.StartAt.In(a.Location.Zone(loc)).Format("02.01 15:04"), a.ServiceName)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, PA+strconv.FormatInt(a.ID, 10)),
+		))
+	}
+	return withBack(rows)
+}
+
+func AppointmentMenu(id int64) tgbotapi.InlineKeyboardMarkup {
+	return withBack([][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔁 Перенести", PR+strconv.FormatInt(id, 10)),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Отменить", PX+strconv.FormatInt(id, 10)),
+		),
+	})
+}
+
+// FormatPrice печатает цену в копейках как рубли.
+func FormatPrice(minor int) string {
+	if minor%100 == 0 {
+		return fmt.Sprintf("%d ₽", minor/100)
+	}
+	return fmt.Sprintf("%d,%02d ₽", minor/100, minor%100)
+}
+
 func HumanDate(iso string) string {
 	t, _ := time.Parse("2006-01-02", iso)
-	return t.Format("02.01 (Mon)")
+	return fmt.Sprintf("%s (%s)", t.Format("02.01"), weekdayNames[t.Weekday()])
 }
 
 // ---------- Rendering по состоянию ----------
 
-func RenderText(sess *Session) string {
+// Screen — текст и клавиатура, которыми редактируется сообщение бота.
+type Screen struct {
+	Text     string
+	Keyboard tgbotapi.InlineKeyboardMarkup
+}
+
+// Renderer строит экраны по состоянию сессии; каталоги филиалов, мастеров и услуг берёт
+// из репозитория. Свободное время показывается с учётом политики записи в часовом поясе
+// филиала (loc — если он не выбран или неизвестен).
+type Renderer struct {
+	repo   model.Repo
+	loc    *time.Location
+	policy BookingPolicy
+}
+
+func NewRenderer(repo model.Repo, loc *time.Location, policy BookingPolicy) *Renderer {
+	return &Renderer{repo: repo, loc: loc, policy: policy}
+}
+
+func (r *Renderer) Render(ctx context.Context, sess *Session) (Screen, error) {
 	switch sess.State {
 	case StateStart:
-		return ""
+		return Screen{Text: "", Keyboard: StartMenu()}, nil
 	case StateMain:
-		return "Выберите действие:"
-	case StateBookService:
-		return "Выберите услугу:"
+		return Screen{Text: "Выберите действие:", Keyboard: MainMenu()}, nil
+	case StateBookLocation:
+		locations, err := r.repo.ListActiveLocations(ctx)
+		if err != nil {
+			return Screen{}, errs.New("failed to list locations").Wrap(err)
+		}
+		return Screen{Text: "Выберите филиал:", Keyboard: LocationMenu(locations)}, nil
 	case StateBookMaster:
-		return "Выберите мастера:"
+		masters, err := ActiveMasters(ctx, r.repo, sess.Booking.LocationID)
+		if err != nil {
+			return Screen{}, err
+		}
+		if len(masters) == 0 {
+			return Screen{Text: "Сейчас нет доступных мастеров.", Keyboard: withBack(nil)}, nil
+		}
+		return Screen{Text: "Выберите мастера:", Keyboard: MastersMenu(masters)}, nil
+	case StateBookService:
+		var services []model.Service
+		var err error
+		if sess.Booking.AnyMaster {
+			services, err = AnyMasterServices(ctx, r.repo, sess.Booking.LocationID)
+		} else {
+			services, err = r.repo.ListServicesByMaster(ctx, sess.Booking.MasterID)
+		}
+		if err != nil {
+			return Screen{}, errs.New("failed to list services").
+				Arg("master", sess.Booking.MasterID).Wrap(err)
+		}
+		if len(services) == 0 {
+			return Screen{Text: "У этого мастера пока нет услуг.", Keyboard: withBack(nil)}, nil
+		}
+		return Screen{Text: "Выберите услугу:", Keyboard: ServiceMenu(services)}, nil
 	case StateBookDate:
-		return "Выберите дату:"
+		return r.renderDate(ctx, sess)
 	case StateBookTime:
-		return "Выберите время:"
+		return r.renderTime(ctx, sess)
 	case StateBookConfirm:
-		return fmt.Sprintf(
-			"Проверьте запись:\nУслуга: %s\nМастер: %s\nДата: %s\nВремя: %s",
-			Title(sess.Booking.Service), Title(sess.Booking.Master),
+		title := "Проверьте запись:"
+		if sess.Booking.RescheduleID != 0 {
+			title = "Перенести запись на новое время?"
+		}
+		text := title
+		if sess.Booking.LocationName != "" {
+			text += "\nФилиал: " + sess.Booking.LocationName
+		}
+		text += fmt.Sprintf(
+			"\nМастер: %s\nУслуга: %s\nДата: %s\nВремя: %s",
+			sess.Booking.MasterName, sess.Booking.ServiceName,
 			HumanDate(sess.Booking.Date), sess.Booking.Time,
 		)
+		return Screen{Text: text, Keyboard: ConfirmMenu(sess.Booking.ConfirmKey)}, nil
 	case StateMy:
-		return "Ваши записи (заглушка):\n— 21.08 14:00, Стрижка, Андрей"
+		return r.renderMy(ctx, sess)
+	case StateMyDetails:
+		return r.renderAppointment(ctx, sess)
 	case StateHelp:
-		return "Помощь (заглушка):\nНажмите «Запись», чтобы выбрать услугу и время."
+		return Screen{
+			Text: "Помощь:\nНажмите «Запись», чтобы выбрать мастера, услугу и время.\n" +
+				r.policy.Summary(),
+			Keyboard: withBack(nil),
+		}, nil
 	default:
-		return "Меню"
+		return Screen{Text: "Меню", Keyboard: MainMenu()}, nil
 	}
 }
 
-func RenderKeyboard(sess *Session) tgbotapi.InlineKeyboardMarkup {
-	switch sess.State {
-	case StateStart:
-		return StartMenu()
-	case StateMain:
-		return MainMenu()
-	case StateBookService:
-		return ServiceMenu()
-	case StateBookMaster:
-		return MastersMenu()
-	case StateBookDate:
-		return DateMenu()
-	case StateBookTime:
-		return TimeMenu()
-	case StateBookConfirm:
-		return ConfirmMenu()
-	case StateMy:
-		// Покажем кнопку назад к главному
-		return tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", CbBack)),
-		)
-	case StateHelp:
-		return tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Назад", CbBack)),
-		)
-	default:
-		return MainMenu()
+// nearestFreeSearchDays — на сколько дней вперёд искать ближайшую дату со свободным временем.
+const nearestFreeSearchDays = 14
+
+func (r *Renderer) renderTime(ctx context.Context, sess *Session) (Screen, error) {
+	b := sess.Booking
+	loc := r.zone(b)
+	day, err := time.ParseInLocation("2006-01-02", b.Date, loc)
+	if err != nil {
+		return Screen{}, errs.New("invalid booking date").Arg("date", b.Date).Wrap(err)
+	}
+	slots, err := r.listSlots(ctx, sess, day)
+	if err != nil {
+		return Screen{}, errs.New("failed to list slots").Arg("date", b.Date).Wrap(err)
+	}
+	if len(slots) > 0 {
+		text := fmt.Sprintf("Выберите время на %s:", HumanDate(b.Date))
+		return Screen{Text: text, Keyboard: TimeMenu(slots)}, nil
+	}
+
+	next := ""
+	_, last := r.policy.Horizon(time.Now(), loc)
+	if end := day.AddDate(0, 0, nearestFreeSearchDays); end.Before(last) {
+		last = end
+	}
+	if from := day.AddDate(0, 0, 1); !from.After(last) {
+		days, err := r.freeDays(ctx, sess, from, last)
+		if err != nil {
+			return Screen{}, errs.New("failed to list free days").Arg("date", b.Date).Wrap(err)
+		}
+		if len(days) > 0 {
+			next = days[0].Format("2006-01-02")
+		}
+	}
+	text := fmt.Sprintf("На %s нет свободного времени.", HumanDate(b.Date))
+	if next == "" {
+		text += fmt.Sprintf("\nВ ближайшие %d дней свободных окон тоже нет.", nearestFreeSearchDays)
+	}
+	return Screen{Text: text, Keyboard: NoSlotsMenu(next)}, nil
+}
+
+// zone — часовой пояс филиала записи.
+func (r *Renderer) zone(b BookingData) *time.Location {
+	return model.Zone(b.Timezone, r.loc)
+}
+
+// slotQuery — запрос свободного времени на day для мастера и услуги из сессии.
+func (r *Renderer) slotQuery(sess *Session, day time.Time) model.SlotQuery {
+	return model.SlotQuery{
+		MasterID:            sess.Booking.MasterID,
+		ServiceID:           sess.Booking.ServiceID,
+		Day:                 day,
+		Loc:                 r.zone(sess.Booking),
+		ViewerTgUserID:      sess.UserID,
+		ExceptAppointmentID: sess.Booking.RescheduleID,
+		Grid:                r.policy.Grid,
+		NotBefore:           r.policy.EarliestStart(time.Now()),
 	}
 }
 
+// listSlots — свободное время на day у мастера из сессии или у всех мастеров («Любой мастер»).
+func (r *Renderer) listSlots(ctx context.Context, sess *Session, day time.Time) ([]model.Slot, error) {
+	if sess.Booking.AnyMaster {
+		return AnyMasterSlots(ctx, r.repo, sess.Booking.LocationID, r.slotQuery(sess, day))
+	}
+	return r.repo.ListAvailableSlots(ctx, r.slotQuery(sess, day))
+}
+
+// freeDays — дни с first по last, на которые есть свободное время у мастера из сессии
+// или у кого-то из мастеров («Любой мастер»). Весь диапазон — один запрос к расписанию на мастера.
+func (r *Renderer) freeDays(ctx context.Context, sess *Session, first, last time.Time) ([]time.Time, error) {
+	if sess.Booking.AnyMaster {
+		return AnyMasterFreeDays(ctx, r.repo, sess.Booking.LocationID, r.slotQuery(sess, first), last)
+	}
+	return r.repo.ListFreeDays(ctx, r.slotQuery(sess, first), last)
+}
+
+// myAppointmentsLimit — сколько ближайших записей показывать в «Мои записи».
+const myAppointmentsLimit = 10
+
+func (r *Renderer) renderMy(ctx context.Context, sess *Session) (Screen, error) {
+	u, err := r.repo.GetUserByTG(ctx, sess.UserID)
+	if err != nil {
+		return Screen{}, errs.New("failed to get user").Wrap(err)
+	}
+	var items []model.AppointmentDetails
+	if u != nil {
+		items, err = r.repo.ListUserAppointmentsUpcoming(ctx, u.ID, myAppointmentsLimit)
+		if err != nil {
+			return Screen{}, errs.New("failed to list appointments").Wrap(err)
+		}
+	}
+	if len(items) == 0 {
+		return Screen{Text: "У вас нет предстоящих записей.", Keyboard: withBack(nil)}, nil
+	}
+	return Screen{Text: "Ваши записи:", Keyboard: MyMenu(items, r.loc)}, nil
+}
+
+func (r *Renderer) renderAppointment(ctx context.Context, sess *Session) (Screen, error) {
+	a, err := OwnAppointment(ctx, r.repo, sess.UserID, sess.Booking.AppointmentID)
+	if errors.Is(err, model.ErrNotFound) {
+		return Screen{Text: "Запись не найдена.", Keyboard: withBack(nil)}, nil
+	}
+	if err != nil {
+		return Screen{}, err
+	}
+	where := a.Location.Name
+	if a.Location.Address != "" {
+		where += ", " + a.Location.Address
+	}
+	text := fmt.Sprintf(
+		"Запись:\nУслуга: %s\nМастер: %s\nГде: %s\nКогда: %s\nДлительность: %d мин\nСтоимость: %s",
+		a.ServiceName, a.MasterName, where,
+		a.StartAt.In(a.Location.Zone(r.loc)).Format("02.01.2006 15:04"),
+		a.DurationMin, FormatPrice(a.PriceMinor),
+	)
+	if a.Status != "booked" && a.Status != "confirmed" {
+		return Screen{Text: text, Keyboard: withBack(nil)}, nil
+	}
+	if !r.policy.CanChange(a.StartAt, time.Now()) {
+		text += "\n\n" + r.policy.Explain(model.ErrChangeDeadline)
+		return Screen{Text: text, Keyboard: withBack(nil)}, nil
+	}
+	return Screen{Text: text, Keyboard: AppointmentMenu(a.ID)}, nil
+}
+
 func NewEditMessageCaptionAndMarkup(
 	chatID int64,
 	messageID int,
@@ -251,17 +509,3 @@ func NewEditMessageCaptionAndMarkup(
 	rep := tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, replyMarkup)
 	return capt, rep
 }
-
-func Title(s string) string {
-	switch s {
-	case "haircut":
-		return "Стрижка"
-	case "shave":
-		return "Бритьё"
-	case "andrey":
-		return "Андрей"
-	case "maria":
-		return "Мария"
-	}
-	return s
-}
@@ -0,0 +1,593 @@
+package receiver
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/repository/model"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+)
+
+// Handlers — обработчики экранов бота. Новый экран добавляется здесь: состояние в fsm.go,
+// отрисовка в Renderer и маршрут в Register.
+//
+// Сообщения клиенту и посты в staff-канал не отправляются напрямую: они пишутся в outbox
+// в той же транзакции, что и изменение записи, и уходят через outbox.Dispatcher.
+//
+// Выбранное время удерживается за клиентом (slot_hold) на holdTTL, пока он на экране подтверждения.
+// При записи к «Любому мастеру» мастер выбирается по правилу assign. Время записи, отмена
+// и перенос проверяются по policy. Даты и время — в часовом поясе филиала записи (loc — если
+// он неизвестен).
+type Handlers struct {
+	repo        model.Repo
+	loc         *time.Location
+	policy      BookingPolicy
+	holdTTL     time.Duration
+	assign      AssignRule
+	isStaffChat func(chat *tgbotapi.Chat) bool
+}
+
+func NewHandlers(
+	repo model.Repo,
+	loc *time.Location,
+	policy BookingPolicy,
+	holdTTL time.Duration,
+	assign AssignRule,
+	isStaffChat func(chat *tgbotapi.Chat) bool,
+) *Handlers {
+	return &Handlers{
+		repo:        repo,
+		loc:         loc,
+		policy:      policy,
+		holdTTL:     holdTTL,
+		assign:      assign,
+		isStaffChat: isStaffChat,
+	}
+}
+
+// Register регистрирует маршруты всех экранов.
+func (h *Handlers) Register(r *Router) {
+	r.Handle(CbStart, goTo(StateMain))
+	r.Handle(CbBook, h.startBooking)
+	r.Handle(CbMy, goTo(StateMy))
+	r.Handle(CbHelp, goTo(StateHelp))
+	r.Handle(CbBack, func(c *Context) error {
+		c.Session.Back()
+		return nil
+	})
+
+	r.HandlePrefix(PL, WithInt64(h.selectLocation))
+	r.HandlePrefix(PM, WithInt64(h.selectMaster))
+	r.Handle(CbAnyMaster, h.selectAnyMaster)
+	r.HandlePrefix(PSvc, WithInt64(h.selectService))
+	r.HandlePrefix(PCal, WithMonth(h.showMonth))
+	r.HandlePrefix(PD, WithDate(h.selectDate))
+	r.Handle(CbNoop, func(c *Context) error {
+		c.SkipRender()
+		return nil
+	})
+	r.Handle(CbNoFree, func(c *Context) error {
+		c.SkipRender()
+		c.Notify("На этот день нет свободного времени")
+		return nil
+	})
+	r.HandlePrefix(PT, WithClock(h.selectTime))
+	r.HandlePrefix(POk, h.confirm)
+
+	r.HandlePrefix(PA, WithInt64(h.openAppointment))
+	r.HandlePrefix(PX, WithInt64(h.cancelAppointment))
+	r.HandlePrefix(PR, WithInt64(h.startReschedule))
+
+	r.HandlePrefix(PNoShow, WithInt64(h.noShow), StaffOnly(h.isStaffChat))
+}
+
+// zone — часовой пояс филиала записи.
+func (h *Handlers) zone(b BookingData) *time.Location {
+	return model.Zone(b.Timezone, h.loc)
+}
+
+func goTo(st State) HandlerFunc {
+	return func(c *Context) error {
+		c.Session.Go(st)
+		return nil
+	}
+}
+
+// startBooking начинает новую запись (а не продолжение переноса). Единственный филиал
+// выбирается сам, без отдельного шага.
+func (h *Handlers) startBooking(c *Context) error {
+	c.Session.Booking = BookingData{}
+	locations, err := h.repo.ListActiveLocations(c)
+	if err != nil {
+		return errs.New("failed to list locations").Wrap(err)
+	}
+	if len(locations) > 1 {
+		c.Session.Go(StateBookLocation)
+		return nil
+	}
+	if len(locations) == 1 {
+		c.Session.Booking.setLocation(locations[0])
+	}
+	c.Session.Go(StateBookMaster)
+	return nil
+}
+
+func (h *Handlers) selectLocation(c *Context, id int64) error {
+	location, err := FindLocation(c, h.repo, id)
+	if err != nil {
+		return err
+	}
+	if location == nil {
+		c.Alert("Этот филиал сейчас недоступен.")
+		return nil
+	}
+	c.Session.Booking.setLocation(*location)
+	c.Session.Go(StateBookMaster)
+	return nil
+}
+
+func (h *Handlers) selectMaster(c *Context, id int64) error {
+	master, err := FindMaster(c, h.repo, c.Session.Booking.LocationID, id)
+	if err != nil {
+		return err
+	}
+	if master == nil {
+		c.Alert("Этот мастер сейчас недоступен.")
+		return nil
+	}
+	c.Session.Booking.MasterID, c.Session.Booking.MasterName = master.ID, master.Name
+	c.Session.Booking.AnyMaster = false
+	c.Session.Go(StateBookService)
+	return nil
+}
+
+func (h *Handlers) selectAnyMaster(c *Context) error {
+	c.Session.Booking.MasterID, c.Session.Booking.MasterName = 0, "Любой мастер"
+	c.Session.Booking.AnyMaster = true
+	c.Session.Go(StateBookService)
+	return nil
+}
+
+func (h *Handlers) selectService(c *Context, id int64) error {
+	var svc *model.Service
+	var err error
+	if c.Session.Booking.AnyMaster {
+		svc, err = FindAnyService(c, h.repo, c.Session.Booking.LocationID, id)
+	} else {
+		svc, err = FindService(c, h.repo, c.Session.Booking.MasterID, id)
+	}
+	if err != nil {
+		return err
+	}
+	if svc == nil {
+		c.Alert("Эта услуга у мастера недоступна.")
+		return nil
+	}
+	c.Session.Booking.ServiceID, c.Session.Booking.ServiceName = svc.ID, svc.Name
+	c.Session.Go(StateBookDate)
+	return nil
+}
+
+// showMonth листает календарь; страница календаря не добавляет шаг в историю.
+func (h *Handlers) showMonth(c *Context, month time.Time) error {
+	c.Session.Booking.Month = month.Format("2006-01")
+	return nil
+}
+
+func (h *Handlers) selectDate(c *Context, day time.Time) error {
+	loc := h.zone(c.Session.Booking)
+	y, m, d := day.Date()
+	if err := h.policy.CheckDay(time.Date(y, m, d, 0, 0, 0, 0, loc), time.Now(), loc); err != nil {
+		c.Alert(h.policy.Explain(err))
+		return nil
+	}
+	c.Session.Booking.Date = day.Format("2006-01-02")
+	// «Ближайшая дата» с экрана времени меняет дату без нового шага в истории
+	if c.Session.State != StateBookTime {
+		c.Session.Go(StateBookTime)
+	}
+	return nil
+}
+
+func (h *Handlers) selectTime(c *Context, clock time.Time) error {
+	c.Session.Booking.Time = clock.Format("15:04")
+	err := h.hold(c, h.repo)
+	if errors.Is(err, model.ErrSlotTaken) {
+		c.Session.Booking.Time = ""
+		c.Alert("Это время только что заняли, пожалуйста, выберите другое.")
+		return nil
+	}
+	if errors.Is(err, ErrInPast) || errors.Is(err, ErrTooSoon) || errors.Is(err, ErrTooFar) {
+		c.Session.Booking.Time = ""
+		c.Alert(h.policy.Explain(err))
+		return nil
+	}
+	if err != nil {
+		c.Session.Booking.Time = ""
+		return err
+	}
+	c.Session.Booking.ConfirmKey = newConfirmKey()
+	c.Session.Go(StateBookConfirm)
+	return nil
+}
+
+// newConfirmKey — случайный ключ идемпотентности для кнопки «Подтвердить».
+func newConfirmKey() string {
+	b := make([]byte, 9)
+	_, _ = rand.Read(b) // crypto/rand.Read не возвращает ошибок на поддерживаемых платформах
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hold удерживает выбранное время. Для «Любого мастера» назначает мастера: сначала пробует
+// уже назначенного, затем свободных по правилу h.assign.
+func (h *Handlers) hold(c *Context, repo model.Repo) error {
+	b := &c.Session.Booking
+	if !b.AnyMaster {
+		return h.holdSlot(c, repo)
+	}
+
+	loc := h.zone(*b)
+	day, err := time.ParseInLocation("2006-01-02", b.Date, loc)
+	if err != nil {
+		return errs.New("invalid booking date").Arg("date", b.Date).Wrap(err)
+	}
+	start, err := time.ParseInLocation("2006-01-02 15:04", b.Date+" "+b.Time, loc)
+	if err != nil {
+		return errs.New("invalid booking time").Arg("date", b.Date).Arg("time", b.Time).Wrap(err)
+	}
+	free, err := FreeMastersAt(c, repo, b.LocationID, model.SlotQuery{
+		ServiceID:      b.ServiceID,
+		Day:            day,
+		Loc:            loc,
+		ViewerTgUserID: c.Session.UserID,
+		Grid:           h.policy.Grid,
+		NotBefore:      h.policy.EarliestStart(time.Now()),
+	}, start)
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, 0, len(free))
+	for _, m := range free {
+		ids = append(ids, m.ID)
+	}
+	loads, err := repo.ListMasterLoad(c, ids, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return errs.New("failed to get master load").Wrap(err)
+	}
+	ranked := rankMasters(h.assign, free, loads)
+	for i, m := range ranked {
+		if m.ID == b.MasterID { // уже удерживаем у этого мастера — его и продлеваем
+			ranked[0], ranked[i] = ranked[i], ranked[0]
+			break
+		}
+	}
+
+	for _, m := range ranked {
+		b.MasterID, b.MasterName = m.ID, m.Name
+		err := h.holdSlot(c, repo)
+		if !errors.Is(err, model.ErrSlotTaken) {
+			return err
+		}
+	}
+	b.MasterID, b.MasterName = 0, "Любой мастер"
+	return model.ErrSlotTaken
+}
+
+// holdSlot удерживает выбранное в сессии время за клиентом на h.holdTTL (или продлевает удержание).
+// Время, не подходящее по политике записи, — ErrInPast, ErrTooSoon или ErrTooFar.
+func (h *Handlers) holdSlot(c *Context, repo model.Repo) error {
+	svc, start, end, err := h.bookingSlot(c, repo)
+	if err != nil {
+		return err
+	}
+	if err := h.policy.CheckStart(start, time.Now(), h.zone(c.Session.Booking)); err != nil {
+		return err
+	}
+	err = repo.HoldSlot(c, model.SlotHold{
+		TgUserID:  c.Session.UserID,
+		MasterID:  c.Session.Booking.MasterID,
+		StartAt:   start.UTC(),
+		EndAt:     end.Add(time.Duration(svc.BufferMin) * time.Minute).UTC(),
+		ExpiresAt: time.Now().Add(h.holdTTL).UTC(),
+
+		ExceptAppointmentID: c.Session.Booking.RescheduleID,
+	})
+	if err != nil && !errors.Is(err, model.ErrSlotTaken) {
+		return errs.New("failed to hold slot").Wrap(err)
+	}
+	return err
+}
+
+// confirm создаёт запись по ключу идемпотентности из кнопки: повторное нажатие (или повторная
+// доставка апдейта) с тем же ключом показывает уже созданную запись, а не «время занято».
+func (h *Handlers) confirm(c *Context) error {
+	key := c.Param
+	done, err := h.repo.GetConfirmedAppointment(c, key, c.Session.UserID)
+	if err != nil {
+		return errs.New("failed to check confirm key").Wrap(err)
+	}
+	if done != 0 {
+		return h.confirmed(c, done)
+	}
+	if key != c.Session.Booking.ConfirmKey || c.Session.State != StateBookConfirm {
+		c.Alert("Это подтверждение устарело, выберите время заново.")
+		return nil
+	}
+
+	var text string
+	err = h.repo.WithTx(c, func(tx model.Repo) error {
+		// Продлеваем своё удержание: если оно истекло и время успел удержать другой — ErrSlotTaken.
+		// Для «Любого мастера» здесь же может смениться назначенный мастер
+		if err := h.hold(c, tx); err != nil {
+			return err
+		}
+		b := c.Session.Booking
+		event := model.EventCreated
+		text = bookedText(b.ServiceName, b.MasterName, b.Date, b.Time)
+		if b.RescheduleID != 0 {
+			text = fmt.Sprintf("Готово! Запись перенесена: %s, %s, %s, %s.",
+				b.ServiceName, b.MasterName, HumanDate(b.Date), b.Time)
+			event = model.EventRescheduled
+		}
+		var id int64
+		var err error
+		if b.RescheduleID != 0 {
+			id, err = b.RescheduleID, h.rescheduleAppointment(c, tx)
+		} else {
+			id, err = h.createAppointment(c, tx)
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.SaveConfirmKey(c, key, c.Session.UserID, id); err != nil {
+			return errs.New("failed to save confirm key").Wrap(err)
+		}
+		chatID := c.Query.Message.Chat.ID
+		msgs := []model.OutboxMessage{model.NewChatTextMessage(chatID, text)}
+		if b.RescheduleID == 0 {
+			// К новой записи — адрес филиала точкой на карте, если он заведён
+			a, err := tx.GetAppointmentDetails(c, id)
+			if err != nil {
+				return errs.New("failed to get appointment").Arg("id", id).Wrap(err)
+			}
+			if a.Location.HasVenue() {
+				msgs = append(msgs, model.NewChatVenueMessage(chatID, a.Location))
+			}
+		}
+		msgs = append(msgs, model.NewStaffEventMessage(event, id))
+		return tx.EnqueueOutbox(c, msgs...)
+	})
+	if errors.Is(err, model.ErrNotFound) {
+		// Переносимую запись отменили
+		c.Session.ResetFlow()
+		c.Alert("Запись не найдена или уже отменена.")
+		return nil
+	}
+	if errors.Is(err, model.ErrChangeDeadline) {
+		c.Session.ResetFlow()
+		c.Alert(h.policy.Explain(err))
+		return nil
+	}
+	if errors.Is(err, model.ErrSlotTaken) {
+		// Слот заняли, пока клиент смотрел на экран подтверждения — назад к выбору времени
+		c.Session.Booking.Time = ""
+		c.Session.Back()
+		c.Alert("Это время уже заняли, пожалуйста, выберите другое.")
+		return nil
+	}
+	if errors.Is(err, ErrInPast) || errors.Is(err, ErrTooSoon) || errors.Is(err, ErrTooFar) {
+		// Пока клиент думал, время вышло за рамки политики
+		c.Session.Booking.Time = ""
+		c.Session.Back()
+		c.Alert(h.policy.Explain(err))
+		return nil
+	}
+	if err != nil {
+		c.Alert("Не удалось сохранить запись, попробуйте ещё раз позже.")
+		return err
+	}
+
+	c.Session.ResetFlow() // возвращаемся в главное меню
+	c.Flash(text)
+	return nil
+}
+
+// confirmed повторяет результат уже выполненного подтверждения.
+func (h *Handlers) confirmed(c *Context, id int64) error {
+	a, err := h.repo.GetAppointmentDetails(c, id)
+	if err != nil {
+		return errs.New("failed to get appointment").Arg("id", id).Wrap(err)
+	}
+	start := a.StartAt.In(a.Location.Zone(h.loc))
+	c.Session.ResetFlow()
+	c.Flash(bookedText(a.ServiceName, a.MasterName, start.Format("2006-01-02"), start.Format("15:04")))
+	return nil
+}
+
+func bookedText(service, master, date, clock string) string {
+	return fmt.Sprintf("Готово! Вы записаны: %s, %s, %s, %s.", service, master, HumanDate(date), clock)
+}
+
+// createAppointment сохраняет подтверждённую запись: обновляет пользователя и создаёт appointment.
+func (h *Handlers) createAppointment(c *Context, repo model.Repo) (int64, error) {
+	from, b := c.Query.From, c.Session.Booking
+	userID, err := repo.UpsertUser(c, model.User{
+		TgUserID:  from.ID,
+		TgChatID:  c.Query.Message.Chat.ID,
+		Username:  optional(from.UserName),
+		FirstName: optional(from.FirstName),
+		LastName:  optional(from.LastName),
+	})
+	if err != nil {
+		return 0, errs.New("failed to upsert user").Wrap(err)
+	}
+
+	svc, start, end, err := h.bookingSlot(c, repo)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := repo.CreateAppointment(c, model.Appointment{
+		UserID:    userID,
+		MasterID:  b.MasterID,
+		ServiceID: svc.ID,
+		StartAt:   start.UTC(),
+		EndAt:     end.UTC(),
+	})
+	if err != nil {
+		if errors.Is(err, model.ErrSlotTaken) {
+			return 0, err
+		}
+		return 0, errs.New("failed to create appointment").Wrap(err)
+	}
+	return id, nil
+}
+
+// rescheduleAppointment переносит запись b.RescheduleID на выбранное в сессии время.
+func (h *Handlers) rescheduleAppointment(c *Context, repo model.Repo) error {
+	u, err := repo.GetUserByTG(c, c.Session.UserID)
+	if err != nil {
+		return errs.New("failed to get user").Wrap(err)
+	}
+	if u == nil {
+		return model.ErrNotFound
+	}
+	_, start, end, err := h.bookingSlot(c, repo)
+	if err != nil {
+		return err
+	}
+	cutoff := h.policy.ChangeCutoff(time.Now()).UTC()
+	err = repo.RescheduleAppointment(c, c.Session.Booking.RescheduleID, u.ID, start.UTC(), end.UTC(), cutoff)
+	if err != nil && !errors.Is(err, model.ErrSlotTaken) && !errors.Is(err, model.ErrNotFound) &&
+		!errors.Is(err, model.ErrChangeDeadline) {
+		return errs.New("failed to reschedule appointment").Arg("id", c.Session.Booking.RescheduleID).Wrap(err)
+	}
+	return err
+}
+
+// bookingSlot возвращает выбранную услугу и интервал записи по данным сессии.
+func (h *Handlers) bookingSlot(c *Context, repo model.Repo) (*model.Service, time.Time, time.Time, error) {
+	b := c.Session.Booking
+	svc, err := FindService(c, repo, b.MasterID, b.ServiceID)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+	if svc == nil {
+		return nil, time.Time{}, time.Time{}, errs.New("service is not provided by master").
+			Arg("master", b.MasterID).Arg("service", b.ServiceID)
+	}
+
+	start, err := time.ParseInLocation("2006-01-02 15:04", b.Date+" "+b.Time, h.zone(b))
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, errs.New("invalid booking time").
+			Arg("date", b.Date).Arg("time", b.Time).Wrap(err)
+	}
+	return svc, start, start.Add(time.Duration(svc.DurationMin) * time.Minute), nil
+}
+
+func (h *Handlers) openAppointment(c *Context, id int64) error {
+	c.Session.Booking.AppointmentID = id
+	c.Session.Go(StateMyDetails)
+	return nil
+}
+
+// startReschedule открывает выбор даты и времени для переноса записи с тем же мастером и услугой.
+func (h *Handlers) startReschedule(c *Context, id int64) error {
+	a, err := OwnAppointment(c, h.repo, c.Session.UserID, id)
+	if errors.Is(err, model.ErrNotFound) {
+		c.Alert("Запись не найдена.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if a.Status != "booked" && a.Status != "confirmed" {
+		c.Alert("Эту запись уже нельзя перенести.")
+		return nil
+	}
+	if !h.policy.CanChange(a.StartAt, time.Now()) {
+		c.Alert(h.policy.Explain(model.ErrChangeDeadline))
+		return nil
+	}
+	c.Session.Booking = BookingData{
+		LocationID:    a.Location.ID,
+		LocationName:  a.Location.Name,
+		Timezone:      a.Location.Timezone,
+		MasterID:      a.MasterID,
+		MasterName:    a.MasterName,
+		ServiceID:     a.ServiceID,
+		ServiceName:   a.ServiceName,
+		AppointmentID: a.ID,
+		RescheduleID:  a.ID,
+	}
+	c.Session.Go(StateBookDate)
+	return nil
+}
+
+// cancelAppointment отменяет запись, проверяя, что она принадлежит вызывающему Telegram-пользователю.
+func (h *Handlers) cancelAppointment(c *Context, id int64) error {
+	err := h.cancel(c, id)
+	if errors.Is(err, model.ErrNotFound) {
+		c.Alert("Запись не найдена или уже отменена.")
+		return nil
+	}
+	if errors.Is(err, model.ErrChangeDeadline) {
+		c.Alert(h.policy.Explain(err))
+		return nil
+	}
+	if err != nil {
+		c.Alert("Не удалось отменить запись, попробуйте ещё раз позже.")
+		return err
+	}
+	c.Notify("Запись отменена")
+	c.Session.Booking.AppointmentID = 0
+	c.Session.Back() // назад к списку записей
+	return nil
+}
+
+func (h *Handlers) cancel(c *Context, id int64) error {
+	u, err := h.repo.GetUserByTG(c, c.Session.UserID)
+	if err != nil {
+		return errs.New("failed to get user").Wrap(err)
+	}
+	if u == nil {
+		return model.ErrNotFound
+	}
+	return h.repo.WithTx(c, func(tx model.Repo) error {
+		if err := tx.CancelAppointment(c, id, u.ID, h.policy.ChangeCutoff(time.Now()).UTC()); err != nil {
+			return err
+		}
+		return tx.EnqueueOutbox(c, model.NewStaffEventMessage(model.EventCanceled, id))
+	})
+}
+
+// noShow — персонал отмечает неявку кнопкой на посте в staff-канале.
+func (h *Handlers) noShow(c *Context, id int64) error {
+	c.SkipRender()
+	err := h.repo.WithTx(c, func(tx model.Repo) error {
+		if err := tx.MarkNoShow(c, id); err != nil {
+			return err
+		}
+		return tx.EnqueueOutbox(c, model.NewStaffEventMessage(model.EventNoShow, id))
+	})
+	if errors.Is(err, model.ErrNotFound) {
+		c.Alert("Запись уже закрыта или ещё не началась.")
+		return nil
+	}
+	if err != nil {
+		return errs.New("failed to mark no-show").Arg("id", id).Wrap(err)
+	}
+	c.Notify("Отмечено: клиент не пришёл")
+	return nil
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,147 @@
+package receiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+)
+
+// Logging пишет в лог каждое нажатие: ключ маршрута, длительность и ошибку.
+func Logging() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			started := time.Now()
+			err := next(c)
+			ev := c.Logger.Debug()
+			if err != nil {
+				ev = c.Logger.Error().Err(err)
+			}
+			ev.Int64("user", c.Session.UserID).
+				Str("data", c.Query.Data).
+				Dur("took", time.Since(started)).
+				Msg("callback")
+			return err
+		}
+	}
+}
+
+// Recovery превращает панику обработчика в ошибку, чтобы воркер продолжил работу.
+func Recovery() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = errs.New("handler panic").Arg("panic", fmt.Sprint(p))
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+// Auth пропускает только нажатия живых пользователей на сообщения бота.
+func Auth() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			if c.Query.From == nil || c.Query.From.IsBot || c.Query.Message == nil {
+				return errs.New("callback rejected").Arg("data", c.Query.Data)
+			}
+			return next(c)
+		}
+	}
+}
+
+// StaffOnly пропускает нажатия только из staff-чата (кнопки на постах staff-канала) и только
+// от его администраторов: кнопки на постах канала видят и могут нажать все подписчики.
+func StaffOnly(isStaffChat func(chat *tgbotapi.Chat) bool) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			chat := c.Query.Message.Chat
+			if !isStaffChat(chat) {
+				return errs.New("staff callback outside staff chat").Arg("chat", chat.ID)
+			}
+			admin, err := isChatAdmin(c, chat.ID, c.Query.From.ID)
+			if err != nil {
+				return errs.New("failed to check staff member").Arg("user", c.Query.From.ID).Wrap(err)
+			}
+			if !admin {
+				c.Logger.Warn().Int64("user", c.Query.From.ID).Str("data", c.Query.Data).
+					Msg("staff callback from non-staff")
+				c.SkipRender()
+				c.Alert("Это действие доступно только сотрудникам.")
+				return nil
+			}
+			return next(c)
+		}
+	}
+}
+
+// isChatAdmin спрашивает у Telegram (getChatMember), администратор ли userID в чате chatID.
+func isChatAdmin(c *Context, chatID, userID int64) (bool, error) {
+	resp, err := c.Bot.Request(c, tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID},
+	})
+	if err != nil {
+		return false, err
+	}
+	var member tgbotapi.ChatMember
+	if err := json.Unmarshal(resp.Result, &member); err != nil {
+		return false, errs.New("failed to decode chat member").Wrap(err)
+	}
+	return member.IsCreator() || member.IsAdministrator(), nil
+}
+
+// AnswerCallback гасит «часики» на кнопке (answerCallbackQuery); при сбое без своего
+// ответа обработчика показывает общее сообщение об ошибке.
+func AnswerCallback() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			err := next(c)
+			if err != nil && c.answer.Text == "" {
+				c.Alert("Что-то пошло не так, попробуйте ещё раз позже.")
+			}
+			if _, aerr := c.Bot.Request(c, c.answer); aerr != nil {
+				c.Logger.Warn().Err(aerr).Msg("answer callback")
+			}
+			return err
+		}
+	}
+}
+
+// Render после успешного обработчика перерисовывает экран по состоянию сессии
+// (редактирует то же сообщение); кнопки подписываются codec.
+func Render(renderer *Renderer, codec *Codec) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c *Context) error {
+			if err := next(c); err != nil {
+				return err
+			}
+			if c.skipRender {
+				return nil
+			}
+			screen, err := renderer.Render(c, c.Session)
+			if err != nil {
+				return errs.New("failed to render screen").Wrap(err)
+			}
+			if err := codec.SignMarkup(c.Query.Message.Chat.ID, &screen.Keyboard); err != nil {
+				return errs.New("failed to sign keyboard").Wrap(err)
+			}
+			if c.flash != "" {
+				screen.Text = c.flash + "\n\n" + screen.Text
+			}
+			capt, rep := NewEditMessageCaptionAndMarkup(
+				c.Query.Message.Chat.ID, c.Query.Message.MessageID, screen.Text, screen.Keyboard,
+			)
+			if _, err := c.Bot.Send(c, capt); err != nil {
+				c.Logger.Warn().Err(err).Msg("edit caption")
+			}
+			if _, err := c.Bot.Send(c, rep); err != nil {
+				c.Logger.Warn().Err(err).Msg("edit markup")
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package receiver
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Нарушения политики записи (см. BookingPolicy.CheckStart).
+var (
+	ErrInPast  = errors.New("booking_in_past")
+	ErrTooSoon = errors.New("booking_too_soon")
+	ErrTooFar  = errors.New("booking_too_far")
+)
+
+// BookingPolicy — правила записи: сетка начала слотов, минимальное упреждение, горизонт
+// и крайний срок, после которого запись нельзя отменить или перенести.
+type BookingPolicy struct {
+	Grid           time.Duration // шаг начала слотов; 0 — длительность услуги
+	MinLead        time.Duration // не раньше чем через MinLead от текущего момента
+	HorizonDays    int           // не дальше чем на HorizonDays дней вперёд, включая сегодня
+	ChangeDeadline time.Duration // отмена и перенос — не позже чем за ChangeDeadline до начала
+}
+
+// Horizon возвращает первый и последний день (полночь в loc), на которые можно записаться.
+func (p BookingPolicy) Horizon(now time.Time, loc *time.Location) (time.Time, time.Time) {
+	y, m, d := now.In(loc).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	return today, today.AddDate(0, 0, p.HorizonDays-1)
+}
+
+// EarliestStart — самое раннее время начала записи, которое можно предложить сейчас.
+func (p BookingPolicy) EarliestStart(now time.Time) time.Time {
+	return now.Add(p.MinLead)
+}
+
+// CheckDay проверяет, что на день day (полночь в loc) можно записаться.
+func (p BookingPolicy) CheckDay(day, now time.Time, loc *time.Location) error {
+	first, last := p.Horizon(now, loc)
+	switch {
+	case day.Before(first):
+		return ErrInPast
+	case day.After(last):
+		return ErrTooFar
+	}
+	return nil
+}
+
+// CheckStart проверяет время начала новой (или переносимой) записи.
+func (p BookingPolicy) CheckStart(start, now time.Time, loc *time.Location) error {
+	if start.Before(now) {
+		return ErrInPast
+	}
+	if start.Before(p.EarliestStart(now)) {
+		return ErrTooSoon
+	}
+	y, m, d := start.In(loc).Date()
+	return p.CheckDay(time.Date(y, m, d, 0, 0, 0, 0, loc), now, loc)
+}
+
+// ChangeCutoff — записи, начинающиеся не позже этого момента, уже нельзя отменить или перенести.
+func (p BookingPolicy) ChangeCutoff(now time.Time) time.Time {
+	return now.Add(p.ChangeDeadline)
+}
+
+func (p BookingPolicy) CanChange(start, now time.Time) bool {
+	return start.After(p.ChangeCutoff(now))
+}
+
+// Explain — понятное клиенту объяснение нарушения политики.
+func (p BookingPolicy) Explain(err error) string {
+	switch {
+	case errors.Is(err, ErrInPast):
+		return "Это время уже прошло, выберите другое."
+	case errors.Is(err, ErrTooSoon):
+		return fmt.Sprintf("Записаться можно не позднее чем за %s до начала, выберите время попозже.",
+			humanDuration(p.MinLead))
+	case errors.Is(err, ErrTooFar):
+		return fmt.Sprintf("Записаться можно не больше чем на %d дн. вперёд.", p.HorizonDays)
+	default:
+		return fmt.Sprintf("Отменить или перенести запись можно не позднее чем за %s до начала. "+
+			"Если планы изменились, пожалуйста, свяжитесь с салоном.", humanDuration(p.ChangeDeadline))
+	}
+}
+
+// Summary — правила записи для экрана помощи.
+func (p BookingPolicy) Summary() string {
+	text := fmt.Sprintf("Запись открыта на %d дн. вперёд", p.HorizonDays)
+	if p.MinLead > 0 {
+		text += fmt.Sprintf(", не позднее чем за %s до начала", humanDuration(p.MinLead))
+	}
+	text += "."
+	if p.ChangeDeadline > 0 {
+		text += fmt.Sprintf("\nОтменить или перенести запись можно не позднее чем за %s.",
+			humanDuration(p.ChangeDeadline))
+	}
+	return text
+}
+
+// humanDuration печатает длительность как «2 ч 30 мин».
+func humanDuration(d time.Duration) string {
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case h > 0 && m > 0:
+		return fmt.Sprintf("%d ч %d мин", h, m)
+	case h > 0:
+		return fmt.Sprintf("%d ч", h)
+	default:
+		return fmt.Sprintf("%d мин", m)
+	}
+}
@@ -0,0 +1,93 @@
+package receiver
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("load %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestHorizonUsesSalonDay(t *testing.T) {
+	prev := time.Local
+	time.Local = time.UTC // сервер в UTC
+	t.Cleanup(func() { time.Local = prev })
+
+	moscow := mustLoad(t, "Europe/Moscow")
+	p := BookingPolicy{HorizonDays: 3}
+	// 22:30 UTC — в Москве уже 01:30 следующего дня
+	now := time.Date(2026, 10, 17, 22, 30, 0, 0, time.UTC)
+	first, last := p.Horizon(now, moscow)
+	if got := first.Format("2006-01-02 15:04 MST"); got != "2026-10-18 00:00 MSK" {
+		t.Fatalf("first = %s", got)
+	}
+	if got := last.Format("2006-01-02"); got != "2026-10-20" {
+		t.Fatalf("last = %s", got)
+	}
+	if err := p.CheckDay(time.Date(2026, 10, 17, 0, 0, 0, 0, moscow), now, moscow); !errors.Is(err, ErrInPast) {
+		t.Fatalf("yesterday in salon: err = %v, want ErrInPast", err)
+	}
+}
+
+func TestHorizonAcrossDST(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	p := BookingPolicy{HorizonDays: 3}
+	now := time.Date(2026, 3, 28, 23, 30, 0, 0, berlin)
+	_, last := p.Horizon(now, berlin)
+	// последний день — полночь по местному времени, хотя 29.03 длится 23 часа
+	if got := last.Format("2006-01-02 15:04 MST"); got != "2026-03-30 00:00 CEST" {
+		t.Fatalf("last = %s", got)
+	}
+}
+
+func TestCheckStart(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	p := BookingPolicy{MinLead: time.Hour, HorizonDays: 2}
+	// 01:30 CET, через час будет уже 03:30 CEST
+	now := time.Date(2026, 3, 29, 1, 30, 0, 0, berlin)
+	tests := []struct {
+		name  string
+		start time.Time
+		want  error
+	}{
+		{"уже прошло", time.Date(2026, 3, 29, 1, 0, 0, 0, berlin), ErrInPast},
+		{"меньше упреждения", time.Date(2026, 3, 29, 3, 15, 0, 0, berlin), ErrTooSoon},
+		{"ровно через час", time.Date(2026, 3, 29, 3, 30, 0, 0, berlin), nil},
+		{"последний день горизонта", time.Date(2026, 3, 30, 23, 0, 0, 0, berlin), nil},
+		{"за горизонтом", time.Date(2026, 3, 31, 0, 0, 0, 0, berlin), ErrTooFar},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.CheckStart(tt.start, now, berlin); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplainPastAndLead(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	p := BookingPolicy{MinLead: 2 * time.Hour, HorizonDays: 7}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, berlin)
+
+	// вчерашний день — не «запишитесь за 2 ч», а «уже прошло»
+	past := p.Explain(p.CheckDay(time.Date(2026, 10, 18, 0, 0, 0, 0, berlin), now, berlin))
+	if past != "Это время уже прошло, выберите другое." {
+		t.Fatalf("past day: %q", past)
+	}
+	if got := p.Explain(p.CheckStart(now.Add(-time.Minute), now, berlin)); got != past {
+		t.Fatalf("past start: %q", got)
+	}
+	soon := p.Explain(p.CheckStart(now.Add(time.Hour), now, berlin))
+	if soon != "Записаться можно не позднее чем за 2 ч до начала, выберите время попозже." {
+		t.Fatalf("too soon: %q", soon)
+	}
+}
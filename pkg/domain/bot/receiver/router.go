@@ -0,0 +1,201 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+	"github.com/rs/zerolog"
+)
+
+// BotAPI — часть tgbotapi.BotAPI, через которую обработчики общаются с Telegram.
+type BotAPI interface {
+	Send(ctx context.Context, c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(ctx context.Context, c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
+
+var (
+	// ErrBadParam — параметр в callback data не разбирается.
+	ErrBadParam = errors.New("bad_callback_param")
+	// ErrNoRoute — для callback data не зарегистрирован обработчик.
+	ErrNoRoute = errors.New("no_route")
+)
+
+// Context — одно нажатие на inline-кнопку: запрос, сессия пользователя и ответ на callback.
+type Context struct {
+	context.Context
+
+	Bot     BotAPI
+	Query   *tgbotapi.CallbackQuery
+	Session *Session
+	Logger  zerolog.Logger
+
+	// Key — ключ или префикс маршрута, Param — остаток callback data после префикса.
+	Key   string
+	Param string
+
+	answer     tgbotapi.CallbackConfig
+	flash      string
+	skipRender bool
+}
+
+func NewContext(
+	ctx context.Context,
+	bot BotAPI,
+	cq *tgbotapi.CallbackQuery,
+	sess *Session,
+	logger zerolog.Logger,
+) *Context {
+	return &Context{
+		Context: ctx,
+		Bot:     bot,
+		Query:   cq,
+		Session: sess,
+		Logger:  logger,
+		answer:  tgbotapi.NewCallback(cq.ID, ""),
+	}
+}
+
+// Notify показывает короткое всплывающее уведомление в ответ на нажатие.
+func (c *Context) Notify(text string) {
+	c.answer = tgbotapi.NewCallback(c.Query.ID, text)
+}
+
+// Alert показывает модальное окно с текстом в ответ на нажатие.
+func (c *Context) Alert(text string) {
+	c.answer = tgbotapi.NewCallbackWithAlert(c.Query.ID, text)
+}
+
+// Flash добавляет сообщение над текстом следующего экрана.
+func (c *Context) Flash(text string) {
+	c.flash = text
+}
+
+// SkipRender — обработчик сам отредактировал сообщение, экран по состоянию не рисуем.
+func (c *Context) SkipRender() {
+	c.skipRender = true
+}
+
+// HandlerFunc обрабатывает нажатие; ошибка означает непредвиденный сбой.
+type HandlerFunc func(c *Context) error
+
+// Middleware оборачивает обработчик (логирование, восстановление, ответ на callback и т.д.).
+type Middleware func(next HandlerFunc) HandlerFunc
+
+type prefixRoute struct {
+	prefix string
+	h      HandlerFunc
+}
+
+// Router выбирает обработчик по callback data: сначала точный ключ, затем самый длинный префикс.
+type Router struct {
+	exact    map[string]HandlerFunc
+	prefixes []prefixRoute
+	mw       []Middleware
+}
+
+func NewRouter() *Router {
+	return &Router{exact: make(map[string]HandlerFunc)}
+}
+
+// Use добавляет middleware для всех маршрутов; первый добавленный — самый внешний.
+func (r *Router) Use(mw ...Middleware) {
+	r.mw = append(r.mw, mw...)
+}
+
+// Handle регистрирует обработчик точного ключа (например, CbBack).
+func (r *Router) Handle(key string, h HandlerFunc, mw ...Middleware) {
+	r.exact[key] = chain(h, mw)
+}
+
+// HandlePrefix регистрирует обработчик ключей вида prefix+param (например, PM+"3").
+func (r *Router) HandlePrefix(prefix string, h HandlerFunc, mw ...Middleware) {
+	r.prefixes = append(r.prefixes, prefixRoute{prefix: prefix, h: chain(h, mw)})
+	sort.SliceStable(r.prefixes, func(i, j int) bool {
+		return len(r.prefixes[i].prefix) > len(r.prefixes[j].prefix)
+	})
+}
+
+// Dispatch выполняет общие middleware и маршрут для c.Query.Data. Маршрут выбирается
+// внутри цепочки, поэтому middleware могут переписать данные до выбора (см. VerifyCallback).
+func (r *Router) Dispatch(c *Context) error {
+	return chain(r.route, r.mw)(c)
+}
+
+func (r *Router) route(c *Context) error {
+	return r.match(c)(c)
+}
+
+func (r *Router) match(c *Context) HandlerFunc {
+	data := c.Query.Data
+	if h, ok := r.exact[data]; ok {
+		c.Key = data
+		return h
+	}
+	for _, p := range r.prefixes {
+		if val, ok := Is(data, p.prefix); ok {
+			c.Key, c.Param = p.prefix, val
+			return p.h
+		}
+	}
+	return func(*Context) error {
+		return errs.New("unknown callback").Arg("data", data).Wrap(ErrNoRoute)
+	}
+}
+
+func chain(h HandlerFunc, mw []Middleware) HandlerFunc {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// ---------- Типизированные параметры ----------
+
+// WithInt64 разбирает параметр как ID (например, master.id в "m:3").
+func WithInt64(h func(c *Context, id int64) error) HandlerFunc {
+	return func(c *Context) error {
+		id, err := strconv.ParseInt(c.Param, 10, 64)
+		if err != nil {
+			return errs.New("invalid id param").Arg("param", c.Param).Wrap(ErrBadParam)
+		}
+		return h(c, id)
+	}
+}
+
+// WithDate разбирает параметр как дату YYYY-MM-DD.
+func WithDate(h func(c *Context, day time.Time) error) HandlerFunc {
+	return func(c *Context) error {
+		day, err := time.Parse("2006-01-02", c.Param)
+		if err != nil {
+			return errs.New("invalid date param").Arg("param", c.Param).Wrap(ErrBadParam)
+		}
+		return h(c, day)
+	}
+}
+
+// WithMonth разбирает параметр как месяц YYYY-MM.
+func WithMonth(h func(c *Context, month time.Time) error) HandlerFunc {
+	return func(c *Context) error {
+		month, err := time.Parse("2006-01", c.Param)
+		if err != nil {
+			return errs.New("invalid month param").Arg("param", c.Param).Wrap(ErrBadParam)
+		}
+		return h(c, month)
+	}
+}
+
+// WithClock разбирает параметр как время HH:MM.
+func WithClock(h func(c *Context, clock time.Time) error) HandlerFunc {
+	return func(c *Context) error {
+		clock, err := time.Parse("15:04", c.Param)
+		if err != nil {
+			return errs.New("invalid time param").Arg("param", c.Param).Wrap(ErrBadParam)
+		}
+		return h(c, clock)
+	}
+}
@@ -0,0 +1,134 @@
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/napryag/tg_services_bot/pkg/repository/model"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+)
+
+// SessionStore хранит FSM-сессии между апдейтами. Ключ — Telegram user ID.
+// Load всегда возвращает сессию (новую, если сохранённой нет); изменения видны
+// другим апдейтам только после Save.
+type SessionStore interface {
+	Load(ctx context.Context, userID int64) (*Session, error)
+	Save(ctx context.Context, sess *Session) error
+}
+
+// ---------- In-memory (потокобезопасно, теряется при рестарте) ----------
+
+type MemoryStore struct {
+	mu sync.RWMutex
+	m  map[int64]*Session
+}
+
+var _ SessionStore = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{m: make(map[int64]*Session)}
+}
+
+func (s *MemoryStore) Load(_ context.Context, userID int64) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sess, ok := s.m[userID]; ok {
+		return sess.clone(), nil
+	}
+	return &Session{UserID: userID, State: StateMain}, nil
+}
+
+func (s *MemoryStore) Save(_ context.Context, sess *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[sess.UserID] = sess.clone()
+	return nil
+}
+
+// ---------- Postgres (таблица user_session) ----------
+
+// sessionPayload — содержимое user_session.payload.
+type sessionPayload struct {
+	History []string    `json:"history,omitempty"`
+	Booking BookingData `json:"booking"`
+}
+
+type PGStore struct {
+	repo model.Repo
+}
+
+var _ SessionStore = (*PGStore)(nil)
+
+func NewPGStore(repo model.Repo) *PGStore {
+	return &PGStore{repo: repo}
+}
+
+func (s *PGStore) Load(ctx context.Context, userID int64) (*Session, error) {
+	sess := &Session{UserID: userID, State: StateMain}
+
+	u, err := s.repo.GetUserByTG(ctx, userID)
+	if err != nil {
+		return nil, errs.New("failed to get user").Arg("tg_user_id", userID).Wrap(err)
+	}
+	if u == nil {
+		return sess, nil
+	}
+
+	data, err := s.repo.LoadSession(ctx, u.ID)
+	if err != nil {
+		return nil, errs.New("failed to load session").Arg("user_id", u.ID).Wrap(err)
+	}
+
+	var p sessionPayload
+	if err := remarshal(data.Payload, &p); err != nil {
+		// Битый payload не должен блокировать пользователя — начинаем с главного меню
+		return sess, nil //nolint:nilerr
+	}
+	sess.State = ParseState(data.State)
+	sess.Booking = p.Booking
+	for _, name := range p.History {
+		sess.history = append(sess.history, ParseState(name))
+	}
+	return sess, nil
+}
+
+func (s *PGStore) Save(ctx context.Context, sess *Session) error {
+	u, err := s.repo.GetUserByTG(ctx, sess.UserID)
+	if err != nil {
+		return errs.New("failed to get user").Arg("tg_user_id", sess.UserID).Wrap(err)
+	}
+	userID := int64(0)
+	if u != nil {
+		userID = u.ID
+	} else {
+		// user_session ссылается на app_user; бот работает в личке, поэтому chat_id = user_id
+		userID, err = s.repo.UpsertUser(ctx, model.User{TgUserID: sess.UserID, TgChatID: sess.UserID})
+		if err != nil {
+			return errs.New("failed to upsert user").Arg("tg_user_id", sess.UserID).Wrap(err)
+		}
+	}
+
+	p := sessionPayload{Booking: sess.Booking}
+	for _, st := range sess.history {
+		p.History = append(p.History, st.String())
+	}
+	var payload map[string]any
+	if err := remarshal(p, &payload); err != nil {
+		return errs.New("failed to encode session").Wrap(err)
+	}
+	data := model.SessionData{State: sess.State.String(), Payload: payload}
+	if err := s.repo.SaveSession(ctx, userID, data); err != nil {
+		return errs.New("failed to save session").Arg("user_id", userID).Wrap(err)
+	}
+	return nil
+}
+
+// remarshal перекладывает значение через JSON (struct <-> map для JSONB payload).
+func remarshal(from, to any) error {
+	b, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, to)
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *PGRepo) SaveConfirmKey(ctx context.Context, key string, tgUserID, appointmentID int64) error {
+	const q = `
+		INSERT INTO booking_confirm (idempotency_key, tg_user_id, appointment_id)
+		VALUES ($1,$2,$3);
+	`
+	_, err := r.db.Exec(ctx, q, key, tgUserID, appointmentID)
+	return err
+}
+
+func (r *PGRepo) GetConfirmedAppointment(ctx context.Context, key string, tgUserID int64) (int64, error) {
+	const q = `SELECT appointment_id FROM booking_confirm WHERE idempotency_key=$1 AND tg_user_id=$2`
+	var id int64
+	err := r.db.QueryRow(ctx, q, key, tgUserID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (r *PGRepo) UpdateProcessed(ctx context.Context, updateID int, callbackID string) (bool, error) {
+	// Повтор ловит любой из ключей: тот же update_id или тот же callback в новом апдейте
+	const q = `
+		SELECT EXISTS (
+		    SELECT 1 FROM processed_update
+		    WHERE update_id = $1 OR callback_id = NULLIF($2, '')
+		);
+	`
+	var seen bool
+	err := r.db.QueryRow(ctx, q, updateID, callbackID).Scan(&seen)
+	return seen, err
+}
+
+func (r *PGRepo) SaveProcessedUpdate(ctx context.Context, updateID int, callbackID string) error {
+	const q = `
+		INSERT INTO processed_update (update_id, callback_id)
+		VALUES ($1, NULLIF($2, ''))
+		ON CONFLICT DO NOTHING;
+	`
+	_, err := r.db.Exec(ctx, q, updateID, callbackID)
+	return err
+}
+
+func (r *PGRepo) PurgeUpdates(ctx context.Context, before time.Time) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM processed_update WHERE created_at < $1`, before)
+	return err
+}
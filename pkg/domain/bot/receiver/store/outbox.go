@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/napryag/tg_services_bot/pkg/repository/model"
+)
+
+func (r *PGRepo) EnqueueOutbox(ctx context.Context, msgs ...model.OutboxMessage) error {
+	const q = `INSERT INTO outbox (kind, payload) VALUES ($1,$2)`
+	for _, m := range msgs {
+		if _, err := r.db.Exec(ctx, q, m.Kind, m.Payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *PGRepo) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxMessage, error) {
+	// Захваченные сообщения скрыты от других экземпляров на lease; если процесс упал
+	// до MarkOutboxSent, они вернутся в очередь — доставка at-least-once.
+	// RETURNING порядок не гарантирует, поэтому сортируем во внешнем SELECT
+	const q = `
+		WITH c AS (
+		       SELECT id FROM outbox
+		        WHERE sent_at IS NULL AND next_attempt_at <= now()
+		        ORDER BY id
+		        LIMIT $1
+		        FOR UPDATE SKIP LOCKED
+		), u AS (
+		       UPDATE outbox o
+		          SET attempts = o.attempts + 1,
+		              next_attempt_at = now() + make_interval(secs => $2)
+		         FROM c
+		        WHERE o.id = c.id
+		       RETURNING o.id, o.kind, o.payload, o.attempts
+		)
+		SELECT id, kind, payload, attempts FROM u ORDER BY id;
+	`
+	rows, err := r.db.Query(ctx, q, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.OutboxMessage
+	for rows.Next() {
+		var m model.OutboxMessage
+		if err := rows.Scan(&m.ID, &m.Kind, &m.Payload, &m.Attempts); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (r *PGRepo) MarkOutboxSent(ctx context.Context, id int64) error {
+	_, err := r.db.Exec(ctx, `UPDATE outbox SET sent_at=now(), next_attempt_at=NULL WHERE id=$1`, id)
+	return err
+}
+
+func (r *PGRepo) MarkOutboxFailed(ctx context.Context, id int64, lastErr string, retryAt *time.Time) error {
+	const q = `UPDATE outbox SET last_error=$2, next_attempt_at=$3 WHERE id=$1`
+	_, err := r.db.Exec(ctx, q, id, lastErr, retryAt)
+	return err
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"time"
+
+	"github.com/napryag/tg_services_bot/pkg/repository/model"
+)
+
+// interval — полуоткрытый интервал [a, b) абсолютного времени.
+type interval struct{ a, b time.Time }
+
+// clockRange — рабочий интервал по настенным часам салона: [from, to) от полуночи.
+type clockRange struct{ from, to time.Duration }
+
+// slotParams — всё, что нужно для нарезки свободного времени одного дня, уже без базы.
+type slotParams struct {
+	Day       time.Time // берётся только календарная дата
+	Loc       *time.Location
+	Work      []clockRange
+	Busy      []interval // записи вместе с буфером их услуг и чужие удержания
+	Duration  time.Duration
+	Buffer    time.Duration
+	Grid      time.Duration // 0 — шаг равен длительности, отсчёт от начала интервала
+	NotBefore time.Time
+}
+
+// dayBounds — начало дня day и начало следующего дня в loc. В дни перевода часов
+// между ними 23 или 25 часов.
+func dayBounds(day time.Time, loc *time.Location) (time.Time, time.Time) {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc), time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+}
+
+// clockOf — время суток: для колонки типа time или по настенным часам t.
+func clockOf(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+}
+
+// cutSlots нарезает свободные слоты дня. Сетка и рабочие часы считаются по настенным часам
+// салона, а длительность и пересечения — в абсолютном времени. Поэтому в день перевода
+// часов слоты не сдвигаются: несуществующее время пропускается, а повторяющийся час
+// предлагается один раз. Слоты нарезаются внутри каждого интервала и на перерыв не попадают;
+// услуга должна закончиться до конца интервала, а вместе с буфером — не пересекаться
+// с занятым временем.
+func cutSlots(p slotParams) []model.Slot {
+	step := p.Grid
+	if step <= 0 {
+		step = p.Duration
+	}
+	if step <= 0 {
+		return []model.Slot{}
+	}
+	y, m, d := p.Day.Date()
+	wall := func(c time.Duration) time.Time {
+		h, mi, sec := int(c/time.Hour), int(c%time.Hour/time.Minute), int(c%time.Minute/time.Second)
+		return time.Date(y, m, d, h, mi, sec, 0, p.Loc)
+	}
+
+	slots := []model.Slot{}
+	for _, w := range p.Work {
+		end := wall(w.to)
+		first := w.from
+		if rem := first % step; p.Grid > 0 && rem != 0 {
+			first += step - rem
+		}
+		for c := first; c < w.to; c += step {
+			s := wall(c)
+			if clockOf(s) != c {
+				continue // при переходе на летнее время этого времени в сутках нет
+			}
+			e := s.Add(p.Duration)
+			if e.After(end) {
+				break
+			}
+			if s.Before(p.NotBefore) {
+				continue // слишком скоро (или уже прошло)
+			}
+			if !overlapsAny(s, e.Add(p.Buffer), p.Busy) {
+				slots = append(slots, model.Slot{StartLocal: s, EndLocal: e})
+			}
+		}
+	}
+	return slots
+}
+
+func overlapsAny(a, b time.Time, busy []interval) bool {
+	for _, iv := range busy {
+		if a.Before(iv.b) && iv.a.Before(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// schedule — расписание и занятость мастера на диапазон дней, загруженные разом (см. loadSchedule).
+type schedule struct {
+	loc              *time.Location
+	duration, buffer time.Duration
+	closed           map[string]bool         // YYYY-MM-DD: праздник, отпуск или выходной
+	overrides        map[string][]clockRange // YYYY-MM-DD: особые часы на дату
+	weekly           map[int][]clockRange    // день недели (0=Sunday): недельное расписание
+	busy             []interval
+}
+
+// work — рабочие интервалы дня (перерыв — промежуток между ними). Приоритет:
+// праздник салона > отпуск > выходной > особые часы на дату > недельное расписание.
+func (s *schedule) work(day time.Time) []clockRange {
+	date := day.Format("2006-01-02")
+	if s.closed[date] {
+		return nil
+	}
+	if w, ok := s.overrides[date]; ok {
+		return w
+	}
+	return s.weekly[int(day.Weekday())]
+}
+
+// slots — свободное время на day (полночь в s.loc).
+func (s *schedule) slots(day time.Time, sq model.SlotQuery) []model.Slot {
+	work := s.work(day)
+	if len(work) == 0 {
+		return []model.Slot{} // нет расписания — нет слотов
+	}
+	return cutSlots(slotParams{
+		Day:       day,
+		Loc:       s.loc,
+		Work:      work,
+		Busy:      s.busy,
+		Duration:  s.duration,
+		Buffer:    s.buffer,
+		Grid:      sq.Grid,
+		NotBefore: sq.NotBefore,
+	})
+}
@@ -0,0 +1,267 @@
+package store
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/napryag/tg_services_bot/pkg/repository/model"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("load %s: %v", name, err)
+	}
+	return loc
+}
+
+// withServerZone подменяет часовой пояс сервера на время теста.
+func withServerZone(t *testing.T, loc *time.Location) {
+	t.Helper()
+	prev := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = prev })
+}
+
+func hours(from, to float64) clockRange {
+	return clockRange{from: time.Duration(from * float64(time.Hour)), to: time.Duration(to * float64(time.Hour))}
+}
+
+func starts(slots []model.Slot) []string {
+	out := make([]string, 0, len(slots))
+	for _, s := range slots {
+		out = append(out, s.StartLocal.Format("15:04"))
+	}
+	return out
+}
+
+func assertStarts(t *testing.T, slots []model.Slot, want ...string) {
+	t.Helper()
+	got := starts(slots)
+	if len(got) != len(want) {
+		t.Fatalf("starts = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("starts = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDayBounds(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	tests := []struct {
+		name string
+		day  time.Time
+		want time.Duration
+	}{
+		{"обычный день", time.Date(2026, 3, 28, 0, 0, 0, 0, time.UTC), 24 * time.Hour},
+		{"переход на летнее время", time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC), 23 * time.Hour},
+		{"переход на зимнее время", time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC), 25 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := dayBounds(tt.day, berlin)
+			if got := end.Sub(start); got != tt.want {
+				t.Fatalf("day length = %v, want %v", got, tt.want)
+			}
+			if start.In(berlin).Format("2006-01-02 15:04") != tt.day.Format("2006-01-02")+" 00:00" {
+				t.Fatalf("start = %v", start.In(berlin))
+			}
+		})
+	}
+}
+
+func TestCutSlotsGrid(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+	slots := cutSlots(slotParams{
+		Day:      time.Date(2026, 10, 19, 0, 0, 0, 0, moscow),
+		Loc:      moscow,
+		Work:     []clockRange{hours(10, 12), hours(13.1, 14)},
+		Duration: time.Hour,
+		Grid:     15 * time.Minute,
+	})
+	// второй интервал начинается в 13:06 — первое начало на сетке 13:15, но услуга не успевает
+	assertStarts(t, slots, "10:00", "10:15", "10:30", "10:45", "11:00")
+	for _, s := range slots {
+		if s.StartLocal.Location() != moscow {
+			t.Fatalf("slot in %v, want salon zone", s.StartLocal.Location())
+		}
+	}
+}
+
+func TestCutSlotsWithoutGrid(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+	slots := cutSlots(slotParams{
+		Day:      time.Date(2026, 10, 19, 0, 0, 0, 0, moscow),
+		Loc:      moscow,
+		Work:     []clockRange{hours(10.25, 12.5)},
+		Duration: 45 * time.Minute,
+	})
+	assertStarts(t, slots, "10:15", "11:00", "11:45")
+}
+
+func TestCutSlotsBusyAndBuffer(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+	at := func(h, m int) time.Time { return time.Date(2026, 10, 19, h, m, 0, 0, moscow) }
+	slots := cutSlots(slotParams{
+		Day:  at(0, 0),
+		Loc:  moscow,
+		Work: []clockRange{hours(10, 14)},
+		// запись 11:00–12:00 с буфером 15 минут, занятость из базы приходит в UTC
+		Busy:     []interval{{a: at(11, 0).UTC(), b: at(12, 15).UTC()}},
+		Duration: time.Hour,
+		Buffer:   15 * time.Minute,
+		Grid:     30 * time.Minute,
+	})
+	// 10:00 заканчивается в 11:00, но буфер до 11:15 задевает запись
+	assertStarts(t, slots, "12:30", "13:00")
+}
+
+func TestCutSlotsNotBefore(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, moscow)
+	slots := cutSlots(slotParams{
+		Day:       day,
+		Loc:       moscow,
+		Work:      []clockRange{hours(10, 12)},
+		Duration:  time.Hour,
+		Grid:      30 * time.Minute,
+		NotBefore: day.Add(10*time.Hour + 10*time.Minute).UTC(),
+	})
+	assertStarts(t, slots, "10:30", "11:00")
+}
+
+func TestCutSlotsSpringForward(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	// 29.03.2026 в Берлине 02:00 сразу становится 03:00
+	slots := cutSlots(slotParams{
+		Day:      time.Date(2026, 3, 29, 0, 0, 0, 0, berlin),
+		Loc:      berlin,
+		Work:     []clockRange{hours(0, 5)},
+		Duration: 30 * time.Minute,
+		Grid:     30 * time.Minute,
+	})
+	assertStarts(t, slots, "00:00", "00:30", "01:00", "01:30", "03:00", "03:30", "04:00", "04:30")
+	for _, s := range slots {
+		if got := s.EndLocal.Sub(s.StartLocal); got != 30*time.Minute {
+			t.Fatalf("slot %s lasts %v", s.StartLocal.Format("15:04"), got)
+		}
+	}
+	// слот 01:30 CET заканчивается в 03:00 CEST
+	if end := slots[3].EndLocal.Format("15:04"); end != "03:00" {
+		t.Fatalf("01:30 ends at %s, want 03:00", end)
+	}
+}
+
+func TestCutSlotsSpringForwardWorkingDay(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	slots := cutSlots(slotParams{
+		Day:      time.Date(2026, 3, 29, 0, 0, 0, 0, berlin),
+		Loc:      berlin,
+		Work:     []clockRange{hours(9, 11)},
+		Duration: time.Hour,
+		Grid:     time.Hour,
+	})
+	// рабочий день начинается в 09:00 по часам салона, хотя от полуночи прошло 8 часов
+	assertStarts(t, slots, "09:00", "10:00")
+	if got := slots[0].StartLocal.UTC().Format("15:04"); got != "07:00" {
+		t.Fatalf("09:00 CEST = %s UTC, want 07:00", got)
+	}
+}
+
+func TestCutSlotsFallBack(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	// 25.10.2026 в Берлине 03:00 снова становится 02:00 — час 02:00–03:00 повторяется
+	slots := cutSlots(slotParams{
+		Day:      time.Date(2026, 10, 25, 0, 0, 0, 0, berlin),
+		Loc:      berlin,
+		Work:     []clockRange{hours(0, 4)},
+		Duration: time.Hour,
+		Grid:     time.Hour,
+	})
+	assertStarts(t, slots, "00:00", "01:00", "02:00", "03:00")
+	for _, s := range slots {
+		if got := s.EndLocal.Sub(s.StartLocal); got != time.Hour {
+			t.Fatalf("slot %s lasts %v", s.StartLocal.Format("15:04"), got)
+		}
+	}
+
+	// в рабочие часы салона перевод часов не попадает — сетка та же, что в обычный день
+	slots = cutSlots(slotParams{
+		Day:      time.Date(2026, 10, 25, 0, 0, 0, 0, berlin),
+		Loc:      berlin,
+		Work:     []clockRange{hours(10, 12)},
+		Duration: 45 * time.Minute,
+		Grid:     15 * time.Minute,
+	})
+	assertStarts(t, slots, "10:00", "10:15", "10:30", "10:45", "11:00", "11:15")
+}
+
+func TestCutSlotsServerInUTC(t *testing.T) {
+	withServerZone(t, time.UTC)
+	la := mustLoad(t, "America/Los_Angeles")
+	// дата из календаря приходит полуночью UTC; в Лос-Анджелесе это ещё предыдущий вечер
+	day := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	start, end := dayBounds(day, la)
+	if got := start.In(la).Format("2006-01-02 15:04"); got != "2026-11-01 00:00" {
+		t.Fatalf("day start = %s", got)
+	}
+	// 01.11.2026 в Лос-Анджелесе переход на зимнее время
+	if got := end.Sub(start); got != 25*time.Hour {
+		t.Fatalf("day length = %v, want 25h", got)
+	}
+
+	// запись накануне 23:30–00:30 по времени салона занимает начало дня
+	busyStart := time.Date(2026, 10, 31, 23, 30, 0, 0, la).UTC()
+	slots := cutSlots(slotParams{
+		Day:      day,
+		Loc:      la,
+		Work:     []clockRange{hours(0, 2), hours(9, 10)},
+		Busy:     []interval{{a: busyStart, b: busyStart.Add(time.Hour)}},
+		Duration: 30 * time.Minute,
+		Grid:     30 * time.Minute,
+	})
+	assertStarts(t, slots, "00:30", "01:00", "01:30", "09:00", "09:30")
+	for _, s := range slots {
+		if s.StartLocal.In(la).Day() != 1 {
+			t.Fatalf("slot %v is not on the salon's day", s.StartLocal)
+		}
+	}
+	// 09:00 PST — это 17:00 UTC
+	if got := slots[3].StartLocal.UTC().Format("15:04"); got != "17:00" {
+		t.Fatalf("09:00 PST = %s UTC, want 17:00", got)
+	}
+}
+
+func TestCutSlotsIndependentOfServerZone(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+	params := slotParams{
+		Day:      time.Date(2026, 3, 29, 0, 0, 0, 0, moscow),
+		Loc:      moscow,
+		Work:     []clockRange{hours(9, 12)},
+		Duration: time.Hour,
+		Grid:     30 * time.Minute,
+	}
+	var want []time.Time
+	for i, zone := range []string{"UTC", "Europe/Berlin", "America/New_York", "Asia/Tokyo"} {
+		withServerZone(t, mustLoad(t, zone))
+		slots := cutSlots(params)
+		if i == 0 {
+			for _, s := range slots {
+				want = append(want, s.StartLocal)
+			}
+			continue
+		}
+		if len(slots) != len(want) {
+			t.Fatalf("server in %s: %d slots, want %d", zone, len(slots), len(want))
+		}
+		for j, s := range slots {
+			if !s.StartLocal.Equal(want[j]) {
+				t.Fatalf("server in %s: slot %d = %v, want %v", zone, j, s.StartLocal, want[j])
+			}
+		}
+	}
+}
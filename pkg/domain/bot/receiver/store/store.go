@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -13,7 +12,19 @@ import (
 	"github.com/napryag/tg_services_bot/pkg/repository/model"
 )
 
-type PGRepo struct{ pool *pgxpool.Pool }
+// querier — общее у пула и транзакции: методы репозитория работают с любым из них.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type PGRepo struct {
+	pool *pgxpool.Pool
+	db   querier // pool или открытая транзакция (см. WithTx)
+}
+
+var _ model.Repo = (*PGRepo)(nil)
 
 func NewRepo(ctx context.Context, dsn string) (*PGRepo, error) {
 	pool, err := pgxpool.New(ctx, dsn)
@@ -24,7 +35,39 @@ func NewRepo(ctx context.Context, dsn string) (*PGRepo, error) {
 		pool.Close()
 		return nil, err
 	}
-	return &PGRepo{pool: pool}, nil
+	return &PGRepo{pool: pool, db: pool}, nil
+}
+
+// WithTx выполняет fn в транзакции: репозиторий, переданный в fn, пишет в неё.
+// Вложенный вызов открывает savepoint: его ошибка откатывает только вложенную часть,
+// и внешняя транзакция может продолжаться.
+func (r *PGRepo) WithTx(ctx context.Context, fn func(tx model.Repo) error) error {
+	return r.inTx(ctx, func(tx *PGRepo) error { return fn(tx) })
+}
+
+func (r *PGRepo) inTx(ctx context.Context, fn func(tx *PGRepo) error) error {
+	var (
+		tx  pgx.Tx
+		err error
+	)
+	if outer, inTx := r.db.(pgx.Tx); inTx {
+		tx, err = outer.Begin(ctx) // SAVEPOINT
+	} else {
+		tx, err = r.pool.Begin(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := fn(&PGRepo{pool: r.pool, db: tx}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *PGRepo) Close() {
+	r.pool.Close()
 }
 
 func (r *PGRepo) UpsertUser(ctx context.Context, u model.User) (int64, error) {
@@ -40,12 +83,51 @@ func (r *PGRepo) UpsertUser(ctx context.Context, u model.User) (int64, error) {
 		RETURNING id;
 	`
 	var id int64
-	err := r.pool.QueryRow(ctx, q, u.TgUserID, u.TgChatID, u.Username, u.FirstName, u.LastName).Scan(&id)
+	err := r.db.QueryRow(ctx, q, u.TgUserID, u.TgChatID, u.Username, u.FirstName, u.LastName).Scan(&id)
 	return id, err
 }
 
+func (r *PGRepo) GetUserByTG(ctx context.Context, tgUserID int64) (*model.User, error) {
+	const q = `
+		SELECT id, tg_user_id, tg_chat_id, username, first_name, last_name
+		FROM app_user
+		WHERE tg_user_id = $1;
+	`
+	var u model.User
+	err := r.db.QueryRow(ctx, q, tgUserID).
+		Scan(&u.ID, &u.TgUserID, &u.TgChatID, &u.Username, &u.FirstName, &u.LastName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *PGRepo) ListActiveLocations(ctx context.Context) ([]model.Location, error) {
+	const q = `
+		SELECT id, name, COALESCE(address, ''), COALESCE(timezone, ''), latitude, longitude
+		FROM location WHERE is_active ORDER BY name
+	`
+	rows, err := r.db.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.Location
+	for rows.Next() {
+		var l model.Location
+		if err := rows.Scan(&l.ID, &l.Name, &l.Address, &l.Timezone, &l.Latitude, &l.Longitude); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
 func (r *PGRepo) ListActiveMasters(ctx context.Context) ([]model.Master, error) {
-	rows, err := r.pool.Query(ctx, `SELECT id,name,is_active FROM master WHERE is_active ORDER BY name`)
+	rows, err := r.db.Query(ctx, `SELECT id,name,is_active,location_id FROM master WHERE is_active ORDER BY name`)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +135,7 @@ func (r *PGRepo) ListActiveMasters(ctx context.Context) ([]model.Master, error)
 	var out []model.Master
 	for rows.Next() {
 		var m model.Master
-		if err := rows.Scan(&m.ID, &m.Name, &m.IsActive); err != nil {
+		if err := rows.Scan(&m.ID, &m.Name, &m.IsActive, &m.LocationID); err != nil {
 			return nil, err
 		}
 		out = append(out, m)
@@ -62,14 +144,16 @@ func (r *PGRepo) ListActiveMasters(ctx context.Context) ([]model.Master, error)
 }
 
 func (r *PGRepo) ListServicesByMaster(ctx context.Context, masterID int64) ([]model.Service, error) {
+	// Длительность и цена — с учётом индивидуальных значений мастера
 	const q = `
-		SELECT s.id, s.name, s.duration_min, s.price_minor
+		SELECT s.id, s.name, COALESCE(ms.duration_min, s.duration_min), COALESCE(ms.price_minor, s.price_minor),
+		       s.buffer_min
 		FROM master_service ms
 		JOIN service s ON s.id = ms.service_id
 		WHERE ms.master_id = $1
 		ORDER BY s.name;
 	`
-	rows, err := r.pool.Query(ctx, q, masterID)
+	rows, err := r.db.Query(ctx, q, masterID)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +161,7 @@ func (r *PGRepo) ListServicesByMaster(ctx context.Context, masterID int64) ([]mo
 	var out []model.Service
 	for rows.Next() {
 		var s model.Service
-		if err := rows.Scan(&s.ID, &s.Name, &s.DurationMin, &s.PriceMinor); err != nil {
+		if err := rows.Scan(&s.ID, &s.Name, &s.DurationMin, &s.PriceMinor, &s.BufferMin); err != nil {
 			return nil, err
 		}
 		out = append(out, s)
@@ -85,84 +169,250 @@ func (r *PGRepo) ListServicesByMaster(ctx context.Context, masterID int64) ([]mo
 	return out, rows.Err()
 }
 
-func (r *PGRepo) ListAvailableSlots(ctx context.Context, masterID, serviceID int64, day time.Time, loc *time.Location) ([]model.Slot, error) {
-	day = day.In(loc)
-	weekday := int(day.Weekday()) // 0=Sunday
+// ListAvailableSlots ищет свободное время на календарный день sq.Day в часовом поясе салона sq.Loc.
+// Границы дня считаются в sq.Loc, а не в часовом поясе сервера или сессии базы.
+func (r *PGRepo) ListAvailableSlots(ctx context.Context, sq model.SlotQuery) ([]model.Slot, error) {
+	sch, err := r.loadSchedule(ctx, sq, sq.Day, sq.Day)
+	if err != nil {
+		return nil, err
+	}
+	day, _ := dayBounds(sq.Day, sq.Loc)
+	return sch.slots(day, sq), nil
+}
 
-	// 1) Услуга
-	var durationMin int
-	if err := r.pool.QueryRow(ctx, `SELECT duration_min FROM service WHERE id=$1`, serviceID).Scan(&durationMin); err != nil {
+func (r *PGRepo) ListFreeDays(ctx context.Context, sq model.SlotQuery, last time.Time) ([]time.Time, error) {
+	sch, err := r.loadSchedule(ctx, sq, sq.Day, last)
+	if err != nil {
 		return nil, err
 	}
-	step := time.Duration(durationMin) * time.Minute
+	first, _ := dayBounds(sq.Day, sq.Loc)
+	end, _ := dayBounds(last, sq.Loc)
+	var out []time.Time
+	for day := first; !day.After(end); day = day.AddDate(0, 0, 1) {
+		if len(sch.slots(day, sq)) > 0 {
+			out = append(out, day)
+		}
+	}
+	return out, nil
+}
+
+// loadSchedule загружает расписание мастера sq.MasterID и занятость на дни [first, last]
+// (календарные даты в sq.Loc) за фиксированное число запросов, независимо от числа дней.
+func (r *PGRepo) loadSchedule(ctx context.Context, sq model.SlotQuery, first, last time.Time) (*schedule, error) {
+	if sq.Loc == nil {
+		return nil, errors.New("slot query without location")
+	}
+	masterID, serviceID := sq.MasterID, sq.ServiceID
+	rangeStart, _ := dayBounds(first, sq.Loc)
+	lastStart, rangeEnd := dayBounds(last, sq.Loc)
+	dateFrom, dateTo := rangeStart.Format("2006-01-02"), lastStart.Format("2006-01-02")
+	sch := &schedule{
+		loc:       sq.Loc,
+		closed:    make(map[string]bool),
+		overrides: make(map[string][]clockRange),
+		weekly:    make(map[int][]clockRange),
+	}
 
-	// 2) Рабочие часы и выходные
-	var tStart, tEnd time.Time
-	{
-		var st, en time.Time
-		// берём локальную дату+время (time type -> отн. 0001-01-01), комбинируем с датой
-		err := r.pool.QueryRow(ctx, `SELECT time_start::time, time_end::time FROM working_hours WHERE master_id=$1 AND dow=$2`, masterID, weekday).Scan(&st, &en)
-		if err != nil {
-			// нет расписания — нет слотов
-			return []model.Slot{}, nil
+	// 1) Услуга: длительность у этого мастера и буфер после неё
+	const qDuration = `
+		SELECT COALESCE(ms.duration_min, s.duration_min), s.buffer_min
+		FROM service s
+		LEFT JOIN master_service ms ON ms.service_id = s.id AND ms.master_id = $2
+		WHERE s.id = $1;
+	`
+	var durationMin, bufferMin int
+	if err := r.db.QueryRow(ctx, qDuration, serviceID, masterID).Scan(&durationMin, &bufferMin); err != nil {
+		return nil, err
+	}
+	sch.duration = time.Duration(durationMin) * time.Minute
+	sch.buffer = time.Duration(bufferMin) * time.Minute
+
+	// 2) Закрытые дни: праздник салона, отпуск или выходной мастера
+	const qClosed = `
+		SELECT to_char(d, 'YYYY-MM-DD')
+		FROM (SELECT $2::date + i AS d FROM generate_series(0, $3::date - $2::date) i) days
+		WHERE EXISTS (SELECT 1 FROM salon_holiday WHERE day = d)
+		   OR EXISTS (SELECT 1 FROM vacation WHERE master_id=$1 AND d BETWEEN date_from AND date_to)
+		   OR EXISTS (SELECT 1 FROM day_off WHERE master_id=$1 AND day = d);
+	`
+	err := r.collect(ctx, func(rows pgx.Rows) error {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			return err
 		}
-		year, month, dayN := day.Date()
-		tStart = time.Date(year, month, dayN, st.Hour(), st.Minute(), st.Second(), 0, loc)
-		tEnd = time.Date(year, month, dayN, en.Hour(), en.Minute(), en.Second(), 0, loc)
+		sch.closed[date] = true
+		return nil
+	}, qClosed, masterID, dateFrom, dateTo)
+	if err != nil {
+		return nil, err
+	}
 
-		var dummy int
-		err = r.pool.QueryRow(ctx, `SELECT 1 FROM day_off WHERE master_id=$1 AND day=$2::date`, masterID, day).Scan(&dummy)
-		if err == nil {
-			return []model.Slot{}, nil // выходной день
+	// 3) Рабочие интервалы: особые часы на даты и недельное расписание
+	// (time type -> отн. 0000-01-01, берём только время суток)
+	const qOverrides = `
+		SELECT to_char(day, 'YYYY-MM-DD'), time_start, time_end FROM schedule_override
+		WHERE master_id=$1 AND day BETWEEN $2::date AND $3::date
+		ORDER BY day, time_start;
+	`
+	err = r.collect(ctx, func(rows pgx.Rows) error {
+		var date string
+		var st, en time.Time
+		if err := rows.Scan(&date, &st, &en); err != nil {
+			return err
 		}
+		sch.overrides[date] = append(sch.overrides[date], clockRange{from: clockOf(st), to: clockOf(en)})
+		return nil
+	}, qOverrides, masterID, dateFrom, dateTo)
+	if err != nil {
+		return nil, err
+	}
+	const qWeekly = `
+		SELECT dow, time_start, time_end FROM working_hours
+		WHERE master_id=$1
+		ORDER BY dow, time_start;
+	`
+	err = r.collect(ctx, func(rows pgx.Rows) error {
+		var dow int
+		var st, en time.Time
+		if err := rows.Scan(&dow, &st, &en); err != nil {
+			return err
+		}
+		sch.weekly[dow] = append(sch.weekly[dow], clockRange{from: clockOf(st), to: clockOf(en)})
+		return nil
+	}, qWeekly, masterID)
+	if err != nil {
+		return nil, err
 	}
 
-	// 3) Забронированные интервалы (UTC → локаль)
+	// 4) Забронированные (вместе с буфером их услуг) и удерживаемые другими интервалы,
+	// пересекающиеся с [rangeStart, rangeEnd)
 	const qBusy = `
+		SELECT a.start_at, a.end_at + make_interval(mins => s.buffer_min)
+		FROM appointment a
+		JOIN service s ON s.id = a.service_id
+		WHERE a.master_id=$1
+		  AND a.id <> $5
+		  AND a.status IN ('booked','confirmed')
+		  AND tstzrange(a.start_at, a.end_at + make_interval(mins => s.buffer_min), '[)')
+		      && tstzrange($2, $3, '[)')
+		UNION ALL
 		SELECT start_at, end_at
-		FROM appointment
+		FROM slot_hold
 		WHERE master_id=$1
-		  AND status IN ('booked','confirmed')
-		  AND start_at::date <= ($2::date + INTERVAL '1 day')
-		  AND end_at::date >= $2::date;
+		  AND tg_user_id <> $4
+		  AND expires_at > now()
+		  AND tstzrange(start_at, end_at, '[)') && tstzrange($2, $3, '[)');
 	`
-	rows, err := r.pool.Query(ctx, qBusy, masterID, day)
+	err = r.collect(ctx, func(rows pgx.Rows) error {
+		var iv interval
+		if err := rows.Scan(&iv.a, &iv.b); err != nil {
+			return err
+		}
+		sch.busy = append(sch.busy, iv)
+		return nil
+	}, qBusy, masterID, rangeStart, rangeEnd, sq.ViewerTgUserID, sq.ExceptAppointmentID)
 	if err != nil {
 		return nil, err
 	}
+	return sch, nil
+}
+
+// collect выполняет запрос и передаёт каждую строку в scan.
+func (r *PGRepo) collect(ctx context.Context, scan func(pgx.Rows) error, q string, args ...any) error {
+	rows, err := r.db.Query(ctx, q, args...)
+	if err != nil {
+		return err
+	}
 	defer rows.Close()
-	type iv struct{ a, b time.Time }
-	var busy []iv
 	for rows.Next() {
-		var aUTC, bUTC time.Time
-		if err := rows.Scan(&aUTC, &bUTC); err != nil {
-			return nil, err
+		if err := scan(rows); err != nil {
+			return err
 		}
-		busy = append(busy, iv{a: aUTC.In(loc), b: bUTC.In(loc)})
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
 	}
+	return rows.Err()
+}
+
+func (r *PGRepo) HoldSlot(ctx context.Context, h model.SlotHold) error {
+	return r.inTx(ctx, func(tx *PGRepo) error {
+		db := tx.db
+		// Истёкшие удержания не должны мешать EXCLUDE slot_hold_no_overlap
+		if _, err := db.Exec(ctx, `DELETE FROM slot_hold WHERE expires_at <= now()`); err != nil {
+			return err
+		}
 
-	overlaps := func(a1, a2, b1, b2 time.Time) bool { return a1.Before(b2) && b1.Before(a2) }
+		// Занятость записи — вместе с буфером её услуги
+		const qBooked = `
+			SELECT EXISTS (
+				SELECT 1 FROM appointment a
+				JOIN service s ON s.id = a.service_id
+				WHERE a.master_id=$1
+				  AND a.id <> $4
+				  AND a.status IN ('booked','confirmed')
+				  AND tstzrange(a.start_at, a.end_at + make_interval(mins => s.buffer_min), '[)')
+				      && tstzrange($2, $3, '[)')
+			);
+		`
+		var booked bool
+		row := db.QueryRow(ctx, qBooked, h.MasterID, h.StartAt, h.EndAt, h.ExceptAppointmentID)
+		if err := row.Scan(&booked); err != nil {
+			return err
+		}
+		if booked {
+			return model.ErrSlotTaken
+		}
 
-	var slots []model.Slot
-	for t := tStart; t.Add(step).Equal(tEnd) || t.Add(step).Before(tEnd); t = t.Add(step) {
-		s := t
-		e := t.Add(step)
-		// проверка пересечения
-		conflict := false
-		for _, iv := range busy {
-			if overlaps(s, e, iv.a, iv.b) {
-				conflict = true
-				break
-			}
+		// Пересечение с чужим удержанием — EXCLUDE slot_hold_no_overlap -> 23P01
+		const q = `
+			INSERT INTO slot_hold (tg_user_id, master_id, start_at, end_at, expires_at)
+			VALUES ($1,$2,$3,$4,$5)
+			ON CONFLICT (tg_user_id) DO UPDATE
+			SET master_id=EXCLUDED.master_id, start_at=EXCLUDED.start_at,
+			    end_at=EXCLUDED.end_at, expires_at=EXCLUDED.expires_at;
+		`
+		_, err := db.Exec(ctx, q, h.TgUserID, h.MasterID, h.StartAt, h.EndAt, h.ExpiresAt)
+		var pgerr *pgconn.PgError
+		if errors.As(err, &pgerr) && pgerr.Code == "23P01" {
+			return model.ErrSlotTaken
 		}
-		if !conflict {
-			slots = append(slots, model.Slot{StartLocal: s, EndLocal: e})
+		return err
+	})
+}
+
+func (r *PGRepo) ReleaseHold(ctx context.Context, tgUserID int64) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM slot_hold WHERE tg_user_id=$1`, tgUserID)
+	return err
+}
+
+func (r *PGRepo) ListMasterLoad(
+	ctx context.Context,
+	masterIDs []int64,
+	from, to time.Time,
+) ([]model.MasterLoad, error) {
+	const q = `
+		SELECT m.id,
+		       count(a.id) FILTER (
+		           WHERE a.status IN ('booked','confirmed') AND a.start_at >= $2 AND a.start_at < $3
+		       ),
+		       max(a.created_at) FILTER (WHERE a.status IN ('booked','confirmed'))
+		FROM master m
+		LEFT JOIN appointment a ON a.master_id = m.id
+		WHERE m.id = ANY($1)
+		GROUP BY m.id;
+	`
+	rows, err := r.db.Query(ctx, q, masterIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.MasterLoad
+	for rows.Next() {
+		var l model.MasterLoad
+		if err := rows.Scan(&l.MasterID, &l.Appointments, &l.LastBookedAt); err != nil {
+			return nil, err
 		}
+		out = append(out, l)
 	}
-	return slots, nil
+	return out, rows.Err()
 }
 
 func (r *PGRepo) CreateAppointment(ctx context.Context, a model.Appointment) (int64, error) {
@@ -173,40 +423,164 @@ func (r *PGRepo) CreateAppointment(ctx context.Context, a model.Appointment) (in
 		RETURNING id;
 	`
 	var id int64
-	err := r.pool.QueryRow(ctx, q, a.UserID, a.MasterID, a.ServiceID, a.StartAt, a.EndAt).Scan(&id)
+	err := r.db.QueryRow(ctx, q, a.UserID, a.MasterID, a.ServiceID, a.StartAt, a.EndAt).Scan(&id)
 	if err != nil {
 		// код ошибки уникального/исключающего ограничения
 		var pgerr *pgconn.PgError
 		if errors.As(err, &pgerr) && (pgerr.Code == "23P01" || pgerr.Code == "23505") {
-			return 0, fmt.Errorf("slot_taken")
+			return 0, model.ErrSlotTaken
 		}
 		return 0, err
 	}
 	return id, nil
 }
 
-func (r *PGRepo) CancelAppointment(ctx context.Context, id int64) error {
-	_, err := r.pool.Exec(ctx, `UPDATE appointment SET status='canceled' WHERE id=$1`, id)
-	return err
+func (r *PGRepo) CancelAppointment(ctx context.Context, id, userID int64, cutoff time.Time) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE appointment SET status='canceled'
+		WHERE id=$1 AND user_id=$2 AND status IN ('booked','confirmed') AND start_at > $3
+	`, id, userID, cutoff)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return r.changeRejected(ctx, id, userID)
+	}
+	return nil
+}
+
+// changeRejected объясняет, почему запись не изменилась: она есть, но поздно (ErrChangeDeadline),
+// или её нет среди активных записей пользователя (ErrNotFound).
+func (r *PGRepo) changeRejected(ctx context.Context, id, userID int64) error {
+	var active bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM appointment
+			WHERE id=$1 AND user_id=$2 AND status IN ('booked','confirmed')
+		)
+	`, id, userID).Scan(&active)
+	if err != nil {
+		return err
+	}
+	if active {
+		return model.ErrChangeDeadline
+	}
+	return model.ErrNotFound
+}
+
+func (r *PGRepo) RescheduleAppointment(ctx context.Context, id, userID int64, startAt, endAt, cutoff time.Time) error {
+	return r.inTx(ctx, func(tx *PGRepo) error {
+		// Одним UPDATE: EXCLUDE appointment_no_overlap проверяет новое время без учёта старого -> 23P01
+		tag, err := tx.db.Exec(ctx, `
+			UPDATE appointment SET start_at=$3, end_at=$4
+			WHERE id=$1 AND user_id=$2 AND status IN ('booked','confirmed') AND start_at > $5
+		`, id, userID, startAt, endAt, cutoff)
+		if err != nil {
+			var pgerr *pgconn.PgError
+			if errors.As(err, &pgerr) && pgerr.Code == "23P01" {
+				return model.ErrSlotTaken
+			}
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return tx.changeRejected(ctx, id, userID)
+		}
+		// Напоминания о старом времени больше не актуальны — отправим заново для нового
+		_, err = tx.db.Exec(ctx, `DELETE FROM appointment_reminder WHERE appointment_id=$1`, id)
+		return err
+	})
+}
+
+func (r *PGRepo) MarkNoShow(ctx context.Context, id int64) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE appointment SET status='no_show'
+		WHERE id=$1 AND status IN ('booked','confirmed') AND start_at <= now()
+	`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+	return nil
 }
 
-func (r *PGRepo) ListUserAppointmentsUpcoming(ctx context.Context, userID int64, limit int) ([]model.Appointment, error) {
+func (r *PGRepo) ClaimChannelPost(ctx context.Context, id int64, lease time.Duration) (bool, error) {
 	const q = `
-		SELECT id, user_id, master_id, service_id, start_at, end_at, status
-		FROM appointment
-		WHERE user_id=$1 AND status IN ('booked','confirmed') AND start_at >= now()
-		ORDER BY start_at
+		UPDATE appointment
+		   SET channel_post_claimed_until = now() + make_interval(secs => $2)
+		 WHERE id = $1
+		   AND channel_message_id IS NULL
+		   AND (channel_post_claimed_until IS NULL OR channel_post_claimed_until <= now());
+	`
+	tag, err := r.db.Exec(ctx, q, id, lease.Seconds())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PGRepo) SetChannelMessageID(ctx context.Context, id int64, messageID int) error {
+	const q = `UPDATE appointment SET channel_message_id=$2, channel_post_claimed_until=NULL WHERE id=$1`
+	_, err := r.db.Exec(ctx, q, id, messageID)
+	return err
+}
+
+const selectAppointmentDetails = `
+	SELECT a.id, a.user_id, a.master_id, a.service_id, a.start_at, a.end_at, a.status,
+	       s.name, m.name, l.id, l.name, COALESCE(l.address, ''), COALESCE(l.timezone, ''), l.latitude, l.longitude,
+	       COALESCE(ms.price_minor, s.price_minor),
+	       (EXTRACT(EPOCH FROM a.end_at - a.start_at) / 60)::int,
+	       concat_ws(' ', u.first_name, u.last_name, '@' || u.username), COALESCE(a.channel_message_id, 0)
+	FROM appointment a
+	JOIN service s ON s.id = a.service_id
+	JOIN master m ON m.id = a.master_id
+	JOIN location l ON l.id = m.location_id
+	JOIN app_user u ON u.id = a.user_id
+	LEFT JOIN master_service ms ON ms.master_id = a.master_id AND ms.service_id = a.service_id
+`
+
+func scanAppointmentDetails(row pgx.Row) (model.AppointmentDetails, error) {
+	var a model.AppointmentDetails
+	err := row.Scan(&a.ID, &a.UserID, &a.MasterID, &a.ServiceID, &a.StartAt, &a.EndAt, &a.Status,
+		&a.ServiceName, &a.MasterName,
+		&a.Location.ID, &a.Location.Name, &a.Location.Address, &a.Location.Timezone,
+		&a.Location.Latitude, &a.Location.Longitude,
+		&a.PriceMinor, &a.DurationMin,
+		&a.ClientName, &a.ChannelMessageID)
+	return a, err
+}
+
+func (r *PGRepo) GetAppointmentDetails(ctx context.Context, id int64) (*model.AppointmentDetails, error) {
+	a, err := scanAppointmentDetails(r.db.QueryRow(ctx, selectAppointmentDetails+` WHERE a.id=$1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrNotFound
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *PGRepo) ListUserAppointmentsUpcoming(
+	ctx context.Context,
+	userID int64,
+	limit int,
+) ([]model.AppointmentDetails, error) {
+	const q = selectAppointmentDetails + `
+		WHERE a.user_id=$1 AND a.status IN ('booked','confirmed') AND a.start_at >= now()
+		ORDER BY a.start_at
 		LIMIT $2;
 	`
-	rows, err := r.pool.Query(ctx, q, userID, limit)
+	rows, err := r.db.Query(ctx, q, userID, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var out []model.Appointment
+	var out []model.AppointmentDetails
 	for rows.Next() {
-		var a model.Appointment
-		if err := rows.Scan(&a.ID, &a.UserID, &a.MasterID, &a.ServiceID, &a.StartAt, &a.EndAt, &a.Status); err != nil {
+		a, err := scanAppointmentDetails(rows)
+		if err != nil {
 			return nil, err
 		}
 		out = append(out, a)
@@ -214,10 +588,75 @@ func (r *PGRepo) ListUserAppointmentsUpcoming(ctx context.Context, userID int64,
 	return out, rows.Err()
 }
 
+func (r *PGRepo) ListDueReminders(
+	ctx context.Context,
+	lead, until time.Duration,
+	now time.Time,
+	limit int,
+) ([]model.Reminder, error) {
+	// Записи, созданные уже внутри окна напоминания, пропускаем: клиент только что записался.
+	// Окно закрывается за until до начала: после простоя бота или переноса записи опоздавшее
+	// напоминание не уходит вместе со следующим, более коротким
+	const q = `
+		SELECT a.id, u.tg_chat_id, a.start_at, s.name, m.name, l.timezone
+		FROM appointment a
+		JOIN app_user u ON u.id = a.user_id
+		JOIN service s ON s.id = a.service_id
+		JOIN master m ON m.id = a.master_id
+		JOIN location l ON l.id = m.location_id
+		WHERE a.status IN ('booked','confirmed')
+		  AND a.start_at - make_interval(mins => $4) > $1
+		  AND a.start_at - make_interval(mins => $2) <= $1
+		  AND a.created_at <= a.start_at - make_interval(mins => $2)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM appointment_reminder ar
+		      WHERE ar.appointment_id = a.id AND ar.lead_min = $2
+		  )
+		ORDER BY a.start_at
+		LIMIT $3;
+	`
+	leadMin := int(lead / time.Minute)
+	rows, err := r.db.Query(ctx, q, now, leadMin, limit, int(until/time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.Reminder
+	for rows.Next() {
+		rm := model.Reminder{LeadMin: leadMin}
+		err := rows.Scan(&rm.AppointmentID, &rm.TgChatID, &rm.StartAt,
+			&rm.ServiceName, &rm.MasterName, &rm.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rm)
+	}
+	return out, rows.Err()
+}
+
+func (r *PGRepo) ClaimReminder(ctx context.Context, appointmentID int64, leadMin int) (bool, error) {
+	tag, err := r.db.Exec(ctx, `
+		INSERT INTO appointment_reminder (appointment_id, lead_min)
+		VALUES ($1,$2)
+		ON CONFLICT DO NOTHING
+	`, appointmentID, leadMin)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PGRepo) ReleaseReminder(ctx context.Context, appointmentID int64, leadMin int) error {
+	const q = `DELETE FROM appointment_reminder WHERE appointment_id=$1 AND lead_min=$2`
+	_, err := r.db.Exec(ctx, q, appointmentID, leadMin)
+	return err
+}
+
 func (r *PGRepo) LoadSession(ctx context.Context, userID int64) (*model.SessionData, error) {
 	var s model.SessionData
 	var payload []byte
-	err := r.pool.QueryRow(ctx, `SELECT state, payload FROM user_session WHERE user_id=$1`, userID).Scan(&s.State, &payload)
+	const q = `SELECT state, payload FROM user_session WHERE user_id=$1`
+	err := r.db.QueryRow(ctx, q, userID).Scan(&s.State, &payload)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return &model.SessionData{State: "main", Payload: map[string]any{}}, nil
@@ -230,7 +669,7 @@ func (r *PGRepo) LoadSession(ctx context.Context, userID int64) (*model.SessionD
 
 func (r *PGRepo) SaveSession(ctx context.Context, userID int64, s model.SessionData) error {
 	pb, _ := json.Marshal(s.Payload)
-	_, err := r.pool.Exec(ctx, `
+	_, err := r.db.Exec(ctx, `
 		INSERT INTO user_session (user_id, state, payload, updated_at)
 		VALUES ($1,$2,$3,now())
 		ON CONFLICT (user_id) DO UPDATE
@@ -0,0 +1,98 @@
+package receiver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+	"github.com/rs/zerolog"
+)
+
+// SecretTokenHeader — заголовок, в котором Telegram присылает secret_token из setWebhook.
+const SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Webhook принимает апдейты от Telegram по HTTP и отдаёт их в канал так же, как GetUpdatesChan.
+// Для локальной проверки достаточно отправить POST с JSON апдейта (и заголовком секрета, если он задан).
+type Webhook struct {
+	secret  string
+	updates chan tgbotapi.Update
+	logger  zerolog.Logger
+}
+
+func NewWebhook(secret string, buffer int, logger zerolog.Logger) *Webhook {
+	return &Webhook{
+		secret:  secret,
+		updates: make(chan tgbotapi.Update, buffer),
+		logger:  logger,
+	}
+}
+
+func (w *Webhook) Updates() tgbotapi.UpdatesChannel {
+	return w.updates
+}
+
+// Close закрывает канал апдейтов. Вызывать только после остановки HTTP-сервера.
+func (w *Webhook) Close() {
+	close(w.updates)
+}
+
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := r.Header.Get(SecretTokenHeader)
+	if w.secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(w.secret)) != 1 {
+		w.logger.Warn().Str("remote", r.RemoteAddr).Msg("webhook: bad secret token")
+		http.Error(rw, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, 1<<20)).Decode(&update); err != nil {
+		w.logger.Warn().Err(err).Msg("webhook: bad update payload")
+		http.Error(rw, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case w.updates <- update:
+		rw.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// Telegram повторит доставку, если не получит 200
+		http.Error(rw, "busy", http.StatusServiceUnavailable)
+	}
+}
+
+// WebhookAPI — запросы управления вебхуком (обычно sender.Client, чтобы они шли через лимитер
+// и повторялись по классу ошибки).
+type WebhookAPI interface {
+	Request(ctx context.Context, c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	MakeRequest(ctx context.Context, endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+}
+
+// SetWebhook регистрирует URL вебхука в Telegram вместе с secret_token.
+func SetWebhook(ctx context.Context, api WebhookAPI, link, secret string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return errs.New("invalid webhook url").Arg("url", link).Wrap(err)
+	}
+	params := tgbotapi.Params{"url": u.String()}
+	params.AddNonEmpty("secret_token", secret)
+	if _, err := api.MakeRequest(ctx, "setWebhook", params); err != nil {
+		return errs.New("failed to set webhook").Wrap(err)
+	}
+	return nil
+}
+
+// DeleteWebhook снимает вебхук: пока он установлен, getUpdates не работает.
+func DeleteWebhook(ctx context.Context, api WebhookAPI) error {
+	if _, err := api.Request(ctx, tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return errs.New("failed to delete webhook").Wrap(err)
+	}
+	return nil
+}
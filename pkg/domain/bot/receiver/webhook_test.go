@@ -0,0 +1,125 @@
+package receiver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const testUpdate = `{"update_id": 7, "message": {"message_id": 1, "date": 0,
+	"from": {"id": 42, "is_bot": false, "first_name": "Ann"},
+	"chat": {"id": 42, "type": "private"}, "text": "/start"}}`
+
+func postUpdate(t *testing.T, h http.Handler, secret, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/tg/webhook", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(SecretTokenHeader, secret)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWebhookSecretToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string // настроенный секрет
+		header string // присланный заголовок
+		want   int
+	}{
+		{"верный секрет", "s3cret", "s3cret", http.StatusOK},
+		{"без заголовка", "s3cret", "", http.StatusForbidden},
+		{"чужой секрет", "s3cret", "guess", http.StatusForbidden},
+		{"префикс секрета", "s3cret", "s3cre", http.StatusForbidden},
+		{"секрет не настроен", "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := NewWebhook(tt.secret, 1, zerolog.Nop())
+			rec := postUpdate(t, wh, tt.header, testUpdate)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			select {
+			case u := <-wh.Updates():
+				if tt.want != http.StatusOK {
+					t.Fatalf("rejected update %d reached the channel", u.UpdateID)
+				}
+				if u.UpdateID != 7 || u.Message.Text != "/start" || u.SentFrom().ID != 42 {
+					t.Fatalf("update = %+v", u)
+				}
+			default:
+				if tt.want == http.StatusOK {
+					t.Fatal("accepted update did not reach the channel")
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookRejectsBadRequests(t *testing.T) {
+	wh := NewWebhook("", 1, zerolog.Nop())
+
+	req := httptest.NewRequest(http.MethodGet, "/tg/webhook", nil)
+	rec := httptest.NewRecorder()
+	wh.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET status = %d, want 405", rec.Code)
+	}
+
+	if rec := postUpdate(t, wh, "", "{not json"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad json status = %d, want 400", rec.Code)
+	}
+	oversized := `{"update_id": 1, "pad": "` + strings.Repeat("x", 1<<20) + `"}`
+	if rec := postUpdate(t, wh, "", oversized); rec.Code != http.StatusBadRequest {
+		t.Fatalf("oversized body status = %d, want 400", rec.Code)
+	}
+}
+
+func TestWebhookBusy(t *testing.T) {
+	wh := NewWebhook("", 1, zerolog.Nop())
+	if rec := postUpdate(t, wh, "", testUpdate); rec.Code != http.StatusOK {
+		t.Fatalf("first update status = %d", rec.Code)
+	}
+
+	// Очередь полна: запрос ждёт, пока Telegram не оборвёт соединение, и не получает 200
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/tg/webhook", strings.NewReader(testUpdate)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	wh.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503 so that Telegram retries", rec.Code)
+	}
+}
+
+func TestWebhookOverHTTP(t *testing.T) {
+	wh := NewWebhook("s3cret", 1, zerolog.Nop())
+	srv := httptest.NewServer(wh)
+	defer srv.Close()
+
+	body := strings.NewReader(testUpdate)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, srv.URL, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(SecretTokenHeader, "s3cret")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if u := <-wh.Updates(); u.UpdateID != 7 {
+		t.Fatalf("update_id = %d, want 7", u.UpdateID)
+	}
+}
@@ -0,0 +1,115 @@
+package reminder
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/domain/bot/sender"
+	"github.com/napryag/tg_services_bot/pkg/repository/model"
+	"github.com/rs/zerolog"
+)
+
+// Sender — часть tgbotapi.BotAPI, через которую уходят напоминания (обычно sender.Client).
+type Sender interface {
+	Send(ctx context.Context, c tgbotapi.Chattable) (tgbotapi.Message, error)
+}
+
+const (
+	// tickInterval — как часто искать записи, которым пора напомнить.
+	tickInterval = time.Minute
+	// batchSize — сколько напоминаний одного типа отправлять за тик.
+	batchSize = 100
+)
+
+// Scheduler в фоне напоминает клиентам о записях за каждое из leads до начала.
+// Каждое напоминание перед отправкой «захватывается» в appointment_reminder, поэтому
+// после рестарта или при нескольких экземплярах бота дублей не будет.
+type Scheduler struct {
+	repo   model.Repo
+	sender Sender
+	leads  []time.Duration // по убыванию
+	loc    *time.Location  // если часовой пояс филиала неизвестен
+	logger zerolog.Logger
+}
+
+func New(repo model.Repo, sender Sender, leads []time.Duration, loc *time.Location, logger zerolog.Logger) *Scheduler {
+	leads = slices.Clone(leads)
+	slices.SortFunc(leads, func(a, b time.Duration) int { return cmp.Compare(b, a) })
+	return &Scheduler{repo: repo, sender: sender, leads: slices.Compact(leads), loc: loc, logger: logger}
+}
+
+// Run работает до отмены ctx.
+func (s *Scheduler) Run(ctx context.Context) {
+	if len(s.leads) == 0 {
+		return
+	}
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		s.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	now := time.Now()
+	for i, lead := range s.leads {
+		// Напоминание за lead уместно, пока не пора следующего: 24h не шлём вместе с 2h
+		var until time.Duration
+		if i+1 < len(s.leads) {
+			until = s.leads[i+1]
+		}
+		due, err := s.repo.ListDueReminders(ctx, lead, until, now, batchSize)
+		if err != nil {
+			s.logger.Error().Err(err).Dur("lead", lead).Msg("list due reminders")
+			continue
+		}
+		for _, rm := range due {
+			s.remind(ctx, rm)
+		}
+	}
+}
+
+func (s *Scheduler) remind(ctx context.Context, rm model.Reminder) {
+	log := s.logger.With().Int64("appointment", rm.AppointmentID).Int("lead_min", rm.LeadMin).Logger()
+
+	claimed, err := s.repo.ClaimReminder(ctx, rm.AppointmentID, rm.LeadMin)
+	if err != nil {
+		log.Error().Err(err).Msg("claim reminder")
+		return
+	}
+	if !claimed {
+		return // уже отправлено (другим экземпляром или до рестарта)
+	}
+
+	if _, err := s.sender.Send(ctx, tgbotapi.NewMessage(rm.TgChatID, s.text(rm))); err != nil {
+		if errors.Is(err, sender.ErrBlocked) {
+			log.Info().Msg("reminder dropped: bot blocked by user")
+			return
+		}
+		log.Warn().Err(err).Msg("send reminder")
+		// Снимаем отметку, чтобы повторить на следующем тике
+		if err := s.repo.ReleaseReminder(ctx, rm.AppointmentID, rm.LeadMin); err != nil {
+			log.Error().Err(err).Msg("release reminder")
+		}
+		return
+	}
+	log.Info().Msg("reminder sent")
+}
+
+func (s *Scheduler) text(rm model.Reminder) string {
+	start := rm.StartAt.In(model.Zone(rm.Timezone, s.loc))
+	return fmt.Sprintf("Напоминаем о записи: %s в %s — %s, мастер %s.",
+		start.Format("02.01"), start.Format("15:04"),
+		rm.ServiceName, rm.MasterName,
+	)
+}
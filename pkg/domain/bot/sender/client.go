@@ -0,0 +1,179 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// maxAttempts — попыток на временные ошибки (сеть, 5xx).
+	maxAttempts = 3
+	// maxRetryAfter — сколько раз подряд ждать retry_after на 429.
+	maxRetryAfter = 5
+	// defaultRetryAfter — пауза на 429 без retry_after.
+	defaultRetryAfter = time.Second
+)
+
+// Client — общий выход бота в Telegram: все Send/Request проходят через Limiter и
+// повторяются по классу ошибки (см. Classify). Реализует receiver.BotAPI.
+type Client struct {
+	bot     *tgbotapi.BotAPI
+	limiter *Limiter
+	logger  zerolog.Logger
+}
+
+func NewClient(bot *tgbotapi.BotAPI, limiter *Limiter, logger zerolog.Logger) *Client {
+	return &Client{bot: bot, limiter: limiter, logger: logger}
+}
+
+func (c *Client) Send(ctx context.Context, ch tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var msg tgbotapi.Message
+	chat, limited := target(ch)
+	err := c.do(ctx, chat, limited, func() (err error) {
+		msg, err = c.bot.Send(ch)
+		return err
+	})
+	return msg, err
+}
+
+func (c *Client) Request(ctx context.Context, ch tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	chat, limited := target(ch)
+	err := c.do(ctx, chat, limited, func() (err error) {
+		resp, err = c.bot.Request(ch)
+		return err
+	})
+	return resp, err
+}
+
+// MakeRequest вызывает метод API с готовыми параметрами — для запросов, которых нет
+// в tgbotapi (например, setWebhook с secret_token). Лимитируется общим лимитом.
+func (c *Client) MakeRequest(
+	ctx context.Context,
+	endpoint string,
+	params tgbotapi.Params,
+) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := c.do(ctx, "", true, func() (err error) {
+		resp, err = c.bot.MakeRequest(endpoint, params)
+		return err
+	})
+	return resp, err
+}
+
+// GetChat возвращает информацию о чате (getChat).
+func (c *Client) GetChat(ctx context.Context, config tgbotapi.ChatInfoConfig) (tgbotapi.Chat, error) {
+	var chat tgbotapi.Chat
+	resp, err := c.Request(ctx, config)
+	if err != nil {
+		return chat, err
+	}
+	if err := json.Unmarshal(resp.Result, &chat); err != nil {
+		return chat, errs.New("failed to decode chat").Wrap(err)
+	}
+	return chat, nil
+}
+
+// do выполняет запрос с повторами. Ожидание лимита и пауз между повторами прерывается
+// отменой ctx, чтобы остановка бота не ждала retry_after.
+// chat — ключ лимита на чат, limited — ждать ли лимитер (см. target).
+func (c *Client) do(ctx context.Context, chat string, limited bool, call func() error) error {
+	attempts, throttled := 0, 0
+	for {
+		if limited {
+			if err := c.limiter.Wait(ctx, chat); err != nil {
+				return err
+			}
+		}
+
+		err := call()
+		if err == nil {
+			return nil
+		}
+
+		class, retryAfter := Classify(err)
+		log := c.logger.With().Err(err).Str("chat", chat).Logger()
+		switch class {
+		case ClassRetryAfter:
+			throttled++
+			if throttled > maxRetryAfter {
+				return errs.New("telegram rate limit").Arg("chat", chat).Wrap(err)
+			}
+			if retryAfter <= 0 {
+				retryAfter = defaultRetryAfter
+			}
+			log.Warn().Dur("retry_after", retryAfter).Msg("telegram 429, waiting")
+			if err := sleep(ctx, retryAfter); err != nil {
+				return err
+			}
+		case ClassBlocked:
+			log.Warn().Msg("bot blocked, dropping send")
+			return errs.New("bot blocked").Arg("chat", chat).Wrap(errors.Join(ErrBlocked, err))
+		case ClassNotModified:
+			return nil
+		case ClassPermanent:
+			return err
+		case ClassTransient:
+			attempts++
+			if attempts >= maxAttempts {
+				log.Error().Msg("send permanently failed")
+				return err
+			}
+			log.Warn().Int("retry", attempts).Msg("send failed, retrying")
+			if err := sleep(ctx, time.Duration(1<<(attempts-1))*time.Second); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sleep ждёт d или отмены ctx.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// target — чат, в который уходит запрос, для лимита на чат. Ответы на callback
+// (answerCallbackQuery) не лимитируем: их ждёт пользователь, и лимит сообщений на них не действует.
+func target(ch tgbotapi.Chattable) (string, bool) {
+	switch c := ch.(type) {
+	case tgbotapi.CallbackConfig:
+		return "", false
+	case tgbotapi.MessageConfig:
+		return chatKey(c.ChatID, c.ChannelUsername), true
+	case tgbotapi.PhotoConfig:
+		return chatKey(c.ChatID, c.ChannelUsername), true
+	case tgbotapi.VenueConfig:
+		return chatKey(c.ChatID, c.ChannelUsername), true
+	case tgbotapi.EditMessageTextConfig:
+		return chatKey(c.ChatID, c.ChannelUsername), true
+	case tgbotapi.EditMessageCaptionConfig:
+		return chatKey(c.ChatID, c.ChannelUsername), true
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return chatKey(c.ChatID, c.ChannelUsername), true
+	case tgbotapi.DeleteMessageConfig:
+		return chatKey(c.ChatID, c.ChannelUsername), true
+	default:
+		return "", true
+	}
+}
+
+func chatKey(chatID int64, channel string) string {
+	if channel != "" {
+		return channel
+	}
+	return strconv.FormatInt(chatID, 10)
+}
@@ -0,0 +1,77 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func testClient() *Client {
+	return NewClient(nil, NewLimiter(), zerolog.Nop())
+}
+
+// failing возвращает вызов, который отдаёт ошибки по порядку, а затем успех, и счётчик вызовов.
+func failing(errs ...error) (func() error, *int) {
+	calls := 0
+	return func() error {
+		calls++
+		if calls <= len(errs) {
+			return errs[calls-1]
+		}
+		return nil
+	}, &calls
+}
+
+func TestClientRetries(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	badRequest := apiError(400, "Bad Request: chat not found", 0)
+	tests := []struct {
+		name      string
+		errs      []error // ошибки попыток по порядку, дальше — успех
+		wantCalls int
+		wantErr   error
+	}{
+		{"успех", nil, 1, nil},
+		{"429 и успех", []error{apiError(429, "Too Many Requests: retry after 1", 1)}, 2, nil},
+		{"403 не повторяется", []error{apiError(403, "Forbidden: bot was blocked", 0)}, 1, ErrBlocked},
+		{"400 не повторяется", []error{badRequest}, 1, badRequest},
+		{"без изменений — успех", []error{apiError(400, "Bad Request: message is not modified", 0)}, 1, nil},
+		{"сеть и успех", []error{dialErr}, 2, nil},
+		{"сеть до исчерпания попыток", []error{dialErr, dialErr, dialErr, dialErr}, maxAttempts, dialErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // паузы между повторами настоящие
+			call, calls := failing(tt.errs...)
+			err := testClient().do(context.Background(), "", false, call)
+			if *calls != tt.wantCalls {
+				t.Fatalf("calls = %d, want %d", *calls, tt.wantCalls)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("err = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientRetryAfterCanceled(t *testing.T) {
+	call, calls := failing(apiError(429, "Too Many Requests: retry after 30", 30))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// пауза retry_after прерывается отменой ctx, а не досыпается
+	err := testClient().do(ctx, "", false, call)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	if *calls != 1 {
+		t.Fatalf("calls = %d, want 1", *calls)
+	}
+}
@@ -2,7 +2,9 @@ package sender
 
 import (
 	"os"
+	"strconv"
 
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
 	"github.com/napryag/tg_services_bot/pkg/utils/errs"
 )
@@ -33,3 +35,14 @@ func (c *ProcessorConfig) LoadFromEnv() error {
 
 	return nil
 }
+
+// IsChannel сообщает, что chat — это канал из TG_CHANNEL_ID (числовой ID или @username).
+func (c ProcessorConfig) IsChannel(chat *tgbotapi.Chat) bool {
+	if chat == nil {
+		return false
+	}
+	if id, err := strconv.ParseInt(c.channelID, 10, 64); err == nil {
+		return chat.ID == id
+	}
+	return chat.UserName != "" && "@"+chat.UserName == c.channelID
+}
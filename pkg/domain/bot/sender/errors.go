@@ -0,0 +1,61 @@
+package sender
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ErrBlocked — пользователь заблокировал бота (или бота убрали из чата): повторять бессмысленно.
+var ErrBlocked = errors.New("bot_blocked")
+
+// ErrorClass — что делать с ошибкой отправки.
+type ErrorClass int
+
+const (
+	// ClassTransient — сеть или 5xx: можно повторить с backoff.
+	ClassTransient ErrorClass = iota
+	// ClassRetryAfter — 429: повторить не раньше retry_after.
+	ClassRetryAfter
+	// ClassBlocked — 403: отправку отбрасываем.
+	ClassBlocked
+	// ClassPermanent — прочие ошибки API (400 и т.п.), разбора ответа и валидации: повтор не поможет.
+	ClassPermanent
+	// ClassNotModified — 400 «message is not modified»: правка уже применена (например, при повторной
+	// доставке), считаем успехом.
+	ClassNotModified
+)
+
+// notModified — текст ошибки Telegram при правке сообщения без изменений.
+const notModified = "message is not modified"
+
+// Classify разбирает ошибку tgbotapi; для 429 возвращает и паузу из retry_after.
+// Повторяются только сетевые ошибки и таймауты, остальные ошибки вне API — нет.
+func Classify(err error) (ErrorClass, time.Duration) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		var netErr net.Error
+		var urlErr *url.Error
+		if errors.As(err, &netErr) || errors.As(err, &urlErr) {
+			return ClassTransient, 0
+		}
+		return ClassPermanent, 0
+	}
+	switch {
+	case apiErr.Code == http.StatusBadRequest && strings.Contains(apiErr.Message, notModified):
+		return ClassNotModified, 0
+	case apiErr.Code == http.StatusTooManyRequests:
+		return ClassRetryAfter, time.Duration(apiErr.RetryAfter) * time.Second
+	case apiErr.Code == http.StatusForbidden:
+		return ClassBlocked, 0
+	case apiErr.Code >= http.StatusInternalServerError:
+		return ClassTransient, 0
+	default:
+		return ClassPermanent, 0
+	}
+}
@@ -0,0 +1,57 @@
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/napryag/tg_services_bot/pkg/utils/errs"
+)
+
+func apiError(code int, message string, retryAfter int) *tgbotapi.Error {
+	return &tgbotapi.Error{
+		Code:               code,
+		Message:            message,
+		ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: retryAfter},
+	}
+}
+
+func TestClassify(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	tests := []struct {
+		name       string
+		err        error
+		want       ErrorClass
+		retryAfter time.Duration
+	}{
+		{"429 с retry_after", apiError(429, "Too Many Requests", 7), ClassRetryAfter, 7 * time.Second},
+		{"429 без retry_after", apiError(429, "Too Many Requests", 0), ClassRetryAfter, 0},
+		{"403 бот заблокирован", apiError(403, "Forbidden: bot was blocked by the user", 0), ClassBlocked, 0},
+		{"500", apiError(500, "Internal Server Error", 0), ClassTransient, 0},
+		{"502", apiError(502, "Bad Gateway", 0), ClassTransient, 0},
+		{"400", apiError(400, "Bad Request: chat not found", 0), ClassPermanent, 0},
+		{"400 без изменений", apiError(400, "Bad Request: message is not modified", 0), ClassNotModified, 0},
+		{"ошибка соединения", dialErr, ClassTransient, 0},
+		{"ошибка запроса", &url.Error{Op: "Post", URL: "https://api.telegram.org", Err: dialErr},
+			ClassTransient, 0},
+		{"обёрнутая 429", errs.New("failed to send").Wrap(apiError(429, "Too Many Requests", 3)),
+			ClassRetryAfter, 3 * time.Second},
+		{"обёрнутая сетевая", errs.New("failed to send").Wrap(dialErr), ClassTransient, 0},
+		{"битый ответ", &json.SyntaxError{Offset: 1}, ClassPermanent, 0},
+		{"прочая ошибка", errors.New("boom"), ClassPermanent, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, retryAfter := Classify(tt.err)
+			if class != tt.want || retryAfter != tt.retryAfter {
+				t.Fatalf("Classify(%v) = %v, %v; want %v, %v",
+					tt.err, class, retryAfter, tt.want, tt.retryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package sender
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Лимиты Telegram Bot API на исходящие сообщения.
+const (
+	globalRate  = 30.0      // сообщений в секунду на бота
+	privateRate = 1.0       // в секунду в один личный чат
+	groupRate   = 20.0 / 60 // в секунду в одну группу или канал
+	chatBurst   = 3.0       // сколько сообщений в чат можно отправить подряд
+	idleBucket  = time.Minute
+	pruneAbove  = 1024 // при каком числе чатов чистить простаивающие бакеты
+)
+
+// bucket — token bucket: rate токенов в секунду, не больше burst.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  float64
+}
+
+func newBucket(rate, burst float64, now time.Time) *bucket {
+	return &bucket{tokens: burst, last: now, rate: rate, burst: burst}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait — сколько ждать до появления токена.
+func (b *bucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Limiter — общий лимит исходящих запросов: глобальный на бота и отдельный на каждый чат.
+// Один Limiter должен обслуживать все отправки бота, иначе лимиты не сложатся.
+type Limiter struct {
+	mu     sync.Mutex
+	global *bucket
+	chats  map[string]*bucket
+	now    func() time.Time
+}
+
+func NewLimiter() *Limiter {
+	now := time.Now
+	return &Limiter{
+		global: newBucket(globalRate, globalRate, now()),
+		chats:  make(map[string]*bucket),
+		now:    now,
+	}
+}
+
+// Wait блокирует, пока отправку в chat (chat ID или @username) не разрешат оба лимита.
+// Пустой chat — только глобальный лимит.
+func (l *Limiter) Wait(ctx context.Context, chat string) error {
+	for {
+		d := l.reserve(chat)
+		if d == 0 {
+			return nil
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// reserve забирает токены и возвращает 0, либо ничего не забирает и возвращает время ожидания.
+func (l *Limiter) reserve(chat string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.global.refill(now)
+	d := l.global.wait()
+
+	var cb *bucket
+	if chat != "" {
+		cb = l.chat(chat, now)
+		cb.refill(now)
+		d = max(d, cb.wait())
+	}
+	if d > 0 {
+		return d
+	}
+
+	l.global.tokens--
+	if cb != nil {
+		cb.tokens--
+	}
+	return 0
+}
+
+func (l *Limiter) chat(chat string, now time.Time) *bucket {
+	if b, ok := l.chats[chat]; ok {
+		return b
+	}
+	if len(l.chats) > pruneAbove {
+		for k, b := range l.chats {
+			if now.Sub(b.last) > idleBucket {
+				delete(l.chats, k)
+			}
+		}
+	}
+	rate := privateRate
+	// Группы и каналы: отрицательный ID или @username
+	if strings.HasPrefix(chat, "-") || strings.HasPrefix(chat, "@") {
+		rate = groupRate
+	}
+	b := newBucket(rate, chatBurst, now)
+	l.chats[chat] = b
+	return b
+}
@@ -0,0 +1,92 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock — управляемое время для лимитера.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func testLimiter() (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter()
+	l.now = clock.now
+	l.global = newBucket(globalRate, globalRate, clock.t)
+	return l, clock
+}
+
+func TestLimiterPrivateChat(t *testing.T) {
+	l, clock := testLimiter()
+	for i := range int(chatBurst) {
+		if d := l.reserve("42"); d != 0 {
+			t.Fatalf("message %d in burst waits %v", i+1, d)
+		}
+	}
+	if d := l.reserve("42"); d != time.Second {
+		t.Fatalf("after burst wait = %v, want 1s", d)
+	}
+	// ожидание не расходует токен
+	clock.advance(time.Second)
+	if d := l.reserve("42"); d != 0 {
+		t.Fatalf("after 1s wait = %v, want 0", d)
+	}
+	// другой чат лимитом первого не задет
+	if d := l.reserve("43"); d != 0 {
+		t.Fatalf("other chat waits %v", d)
+	}
+}
+
+func TestLimiterGroupAndChannel(t *testing.T) {
+	for _, chat := range []string{"-1001234567890", "@salon_staff"} {
+		t.Run(chat, func(t *testing.T) {
+			l, _ := testLimiter()
+			for range int(chatBurst) {
+				l.reserve(chat)
+			}
+			// 20 сообщений в минуту — одно в 3 секунды
+			if d := l.reserve(chat); d != 3*time.Second {
+				t.Fatalf("wait = %v, want 3s", d)
+			}
+		})
+	}
+}
+
+func TestLimiterGlobal(t *testing.T) {
+	l, clock := testLimiter()
+	for i := range int(globalRate) {
+		if d := l.reserve(""); d != 0 {
+			t.Fatalf("request %d waits %v", i+1, d)
+		}
+	}
+	// глобальный лимит действует и на свежий чат
+	d := l.reserve("42")
+	if want := time.Second / time.Duration(globalRate); d != want {
+		t.Fatalf("wait = %v, want %v", d, want)
+	}
+	clock.advance(d)
+	if d := l.reserve("42"); d != 0 {
+		t.Fatalf("after refill wait = %v", d)
+	}
+}
+
+func TestLimiterWaitCanceled(t *testing.T) {
+	l, _ := testLimiter()
+	for range int(chatBurst) {
+		l.reserve("@salon_staff")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if err := l.Wait(ctx, "@salon_staff"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	if took := time.Since(started); took > time.Second {
+		t.Fatalf("Wait ignored ctx for %v", took)
+	}
+}
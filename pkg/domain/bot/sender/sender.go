@@ -1,8 +1,8 @@
 package sender
 
 import (
-	"math"
-	"time"
+	"context"
+	"strconv"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/napryag/tg_services_bot/pkg/utils/errs"
@@ -13,38 +13,90 @@ type Processor struct {
 	config ProcessorConfig
 	logger zerolog.Logger
 
-	bot *tgbotapi.BotAPI
+	client *Client
 }
 
-func New(config ProcessorConfig, logger zerolog.Logger, bot *tgbotapi.BotAPI) *Processor {
+func New(config ProcessorConfig, logger zerolog.Logger, client *Client) *Processor {
 	return &Processor{
 		config: config,
 		logger: logger,
-		bot:    bot,
+		client: client,
 	}
 }
 
-func (p *Processor) Send(text string) (int, error) {
+// ChatID возвращает числовой ID канала: из TG_CHANNEL_ID или через getChat для @username.
+func (p *Processor) ChatID(ctx context.Context) (int64, error) {
+	if id, err := strconv.ParseInt(p.config.channelID, 10, 64); err == nil {
+		return id, nil
+	}
+	chat, err := p.client.GetChat(ctx, tgbotapi.ChatInfoConfig{
+		ChatConfig: tgbotapi.ChatConfig{SuperGroupUsername: p.config.channelID},
+	})
+	if err != nil {
+		return 0, errs.New("failed to get channel").Arg("channel", p.config.channelID).Wrap(err)
+	}
+	return chat.ID, nil
+}
+
+func (p *Processor) Send(ctx context.Context, text string) (int, error) {
+	return p.Post(ctx, text, nil)
+}
+
+// Post публикует сообщение в канал (с кнопками, если markup не nil) и возвращает его ID.
+func (p *Processor) Post(ctx context.Context, text string, markup *tgbotapi.InlineKeyboardMarkup) (int, error) {
 	p.logger.Trace().Msg("In")
 	defer p.logger.Trace().Msg("Out")
 
 	msgToSend := tgbotapi.NewMessageToChannel(p.config.channelID, text)
+	if markup != nil {
+		msgToSend.ReplyMarkup = *markup
+	}
+
+	msg, err := p.client.Send(ctx, msgToSend)
+	if err != nil {
+		return 0, errs.New("failed to send message").Wrap(err)
+	}
+	return msg.MessageID, nil
+}
 
-	var err error
-	var msg tgbotapi.Message
+// Edit заменяет текст и кнопки ранее опубликованного сообщения messageID.
+func (p *Processor) Edit(ctx context.Context, messageID int, text string, markup *tgbotapi.InlineKeyboardMarkup) error {
+	p.logger.Trace().Msg("In")
+	defer p.logger.Trace().Msg("Out")
 
-	for i := 0; i < 3; i++ {
-		msg, err = p.bot.Send(msgToSend)
-		if err == nil {
-			return msg.MessageID, nil
-		}
-		p.logger.Warn().Err(err).Int("retry", i+1).Msg("send failed, retrying")
+	edit := tgbotapi.EditMessageTextConfig{
+		BaseEdit: tgbotapi.BaseEdit{
+			ChannelUsername: p.config.channelID,
+			MessageID:       messageID,
+			ReplyMarkup:     markup,
+		},
+		Text: text,
+	}
 
-		if i != 0 {
-			time.Sleep(time.Duration(math.Pow(2, float64(i))) * time.Second)
-		}
+	if _, err := p.client.Send(ctx, edit); err != nil {
+		return errs.New("failed to edit message").Arg("message_id", messageID).Wrap(err)
 	}
-	p.logger.Error().Err(err).Msg("send permanently failed")
+	return nil
+}
 
-	return 0, errs.New("failed to send message").Wrap(err)
+// SendTo отправляет текст в личный чат клиента.
+func (p *Processor) SendTo(ctx context.Context, chatID int64, text string) error {
+	if _, err := p.client.Send(ctx, tgbotapi.NewMessage(chatID, text)); err != nil {
+		return errs.New("failed to send message").Arg("chat_id", chatID).Wrap(err)
+	}
+	return nil
+}
+
+// SendVenueTo отправляет клиенту адрес с точкой на карте.
+func (p *Processor) SendVenueTo(
+	ctx context.Context,
+	chatID int64,
+	title, address string,
+	latitude, longitude float64,
+) error {
+	venue := tgbotapi.NewVenue(chatID, title, address, latitude, longitude)
+	if _, err := p.client.Send(ctx, venue); err != nil {
+		return errs.New("failed to send venue").Arg("chat_id", chatID).Wrap(err)
+	}
+	return nil
 }
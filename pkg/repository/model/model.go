@@ -2,9 +2,20 @@ package model
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"time"
 )
 
+// ErrSlotTaken возвращается, когда выбранный интервал уже занят другой записью.
+var ErrSlotTaken = errors.New("slot_taken")
+
+// ErrChangeDeadline возвращается, когда запись уже поздно отменять или переносить.
+var ErrChangeDeadline = errors.New("change_deadline")
+
+// ErrNotFound возвращается, когда запись не найдена или недоступна вызывающему пользователю.
+var ErrNotFound = errors.New("not_found")
+
 type User struct {
 	ID        int64
 	TgUserID  int64
@@ -14,17 +25,43 @@ type User struct {
 	LastName  *string
 }
 
+// Service — услуга; в выдаче ListServicesByMaster DurationMin и PriceMinor уже с учётом
+// индивидуальных значений мастера (master_service).
 type Service struct {
 	ID          int64
 	Name        string
 	DurationMin int
 	PriceMinor  int
+	BufferMin   int // уборка после услуги: мастер занят, но клиенту не показывается
 }
 
 type Master struct {
-	ID       int64
-	Name     string
-	IsActive bool
+	ID         int64
+	Name       string
+	IsActive   bool
+	LocationID int64 // филиал, в котором работает мастер
+}
+
+// Location — филиал салона. Время записей филиала считается в его часовом поясе Timezone (имя IANA).
+type Location struct {
+	ID        int64
+	Name      string
+	Address   string   // пусто — адрес не заведён
+	Timezone  string   // пусто — часовой пояс из конфига
+	Latitude  *float64 // nil — точка на карте не заведена
+	Longitude *float64
+}
+
+// HasVenue — заведены ли адрес и точка на карте. Пока их нет, клиенту адрес не отправляется.
+func (l Location) HasVenue() bool {
+	return l.Address != "" && l.Latitude != nil && l.Longitude != nil
+}
+
+// MasterLoad — загрузка мастера для выбора в режиме «Любой мастер».
+type MasterLoad struct {
+	MasterID     int64
+	Appointments int        // активных записей в запрошенном интервале
+	LastBookedAt *time.Time // когда создана последняя активная запись мастера (nil — таких нет)
 }
 
 type Appointment struct {
@@ -34,7 +71,94 @@ type Appointment struct {
 	ServiceID int64
 	StartAt   time.Time // UTC
 	EndAt     time.Time // UTC
-	Status    string    // booked|confirmed|canceled|done
+	Status    string    // booked|confirmed|canceled|done|no_show
+}
+
+// BookingEvent — событие жизненного цикла записи, о котором сообщаем персоналу.
+type BookingEvent string
+
+const (
+	EventCreated     BookingEvent = "created"
+	EventCanceled    BookingEvent = "canceled"
+	EventRescheduled BookingEvent = "rescheduled"
+	EventNoShow      BookingEvent = "no_show"
+)
+
+// AppointmentDetails — запись вместе с данными услуги и мастера для показа клиенту.
+type AppointmentDetails struct {
+	Appointment
+	ServiceName string
+	MasterName  string
+	Location    Location // филиал мастера записи
+	PriceMinor  int      // цена у мастера записи
+	DurationMin int      // фактическая длительность записи
+
+	ClientName       string // имя и @username клиента для staff-канала
+	ChannelMessageID int    // сообщение о записи в staff-канале, 0 — ещё не публиковали
+}
+
+// Reminder — напоминание о записи, которое пора отправить клиенту.
+type Reminder struct {
+	AppointmentID int64
+	LeadMin       int // за сколько минут до начала
+	TgChatID      int64
+	StartAt       time.Time // UTC
+	ServiceName   string
+	MasterName    string
+	Timezone      string // часовой пояс филиала
+}
+
+// Виды сообщений в outbox.
+const (
+	OutboxChatText   = "chat_text"   // текст клиенту, payload — ChatText
+	OutboxChatVenue  = "chat_venue"  // адрес филиала клиенту, payload — ChatVenue
+	OutboxStaffEvent = "staff_event" // пост в staff-канал, payload — StaffEvent
+)
+
+// OutboxMessage — исходящее сообщение, записанное в одной транзакции с изменением записи.
+type OutboxMessage struct {
+	ID       int64
+	Kind     string
+	Payload  []byte // JSON
+	Attempts int
+}
+
+type ChatText struct {
+	ChatID int64  `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+type ChatVenue struct {
+	ChatID    int64   `json:"chat_id"`
+	Title     string  `json:"title"`
+	Address   string  `json:"address"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type StaffEvent struct {
+	Event         BookingEvent `json:"event"`
+	AppointmentID int64        `json:"appointment_id"`
+}
+
+func NewChatTextMessage(chatID int64, text string) OutboxMessage {
+	return newOutboxMessage(OutboxChatText, ChatText{ChatID: chatID, Text: text})
+}
+
+// NewChatVenueMessage — адрес филиала точкой на карте; вызывать только для l.HasVenue().
+func NewChatVenueMessage(chatID int64, l Location) OutboxMessage {
+	return newOutboxMessage(OutboxChatVenue, ChatVenue{
+		ChatID: chatID, Title: l.Name, Address: l.Address, Latitude: *l.Latitude, Longitude: *l.Longitude,
+	})
+}
+
+func NewStaffEventMessage(event BookingEvent, appointmentID int64) OutboxMessage {
+	return newOutboxMessage(OutboxStaffEvent, StaffEvent{Event: event, AppointmentID: appointmentID})
+}
+
+func newOutboxMessage(kind string, payload any) OutboxMessage {
+	b, _ := json.Marshal(payload) // структуры выше всегда сериализуются
+	return OutboxMessage{Kind: kind, Payload: b}
 }
 
 // Слоты: «момент начала» в локальном часовом поясе для удобства UI
@@ -43,27 +167,109 @@ type Slot struct {
 	EndLocal   time.Time
 }
 
+// SlotQuery — параметры поиска свободного времени на календарный день Day (берётся только дата)
+// в часовом поясе салона Loc; без Loc запрос не выполняется.
+// Слоты, удерживаемые другими пользователями, скрыты; удержания ViewerTgUserID — нет.
+// ExceptAppointmentID — переносимая запись: её текущее время не считается занятым.
+// Grid — шаг сетки, по которой начинаются слоты (от полуночи); 0 — длительность услуги.
+// NotBefore — слоты, начинающиеся раньше, не показываются (минимальное упреждение).
+type SlotQuery struct {
+	MasterID            int64
+	ServiceID           int64
+	Day                 time.Time
+	Loc                 *time.Location
+	ViewerTgUserID      int64
+	ExceptAppointmentID int64
+	Grid                time.Duration
+	NotBefore           time.Time
+}
+
+// SlotHold — временное удержание слота, пока клиент на экране подтверждения.
+// У пользователя не больше одного удержания. EndAt включает буфер услуги.
+type SlotHold struct {
+	TgUserID  int64
+	MasterID  int64
+	StartAt   time.Time
+	EndAt     time.Time
+	ExpiresAt time.Time
+	// ExceptAppointmentID — переносимая запись, с которой удержание может пересекаться
+	ExceptAppointmentID int64
+}
+
 type SessionData struct {
 	State   string
 	Payload map[string]any // ваш booking payload (service/master/date/time и т.д.)
 }
 
 type Repo interface {
+	// WithTx выполняет fn в одной транзакции
+	WithTx(ctx context.Context, fn func(tx Repo) error) error
+
 	// Пользователи
 	UpsertUser(ctx context.Context, u User) (int64, error)
 	GetUserByTG(ctx context.Context, tgUserID int64) (*User, error)
 
 	// Каталоги
+	ListActiveLocations(ctx context.Context) ([]Location, error)
 	ListActiveMasters(ctx context.Context) ([]Master, error)
 	ListServicesByMaster(ctx context.Context, masterID int64) ([]Service, error)
 
-	// Слоты (на основании working_hours, выходных и существующих записей)
-	ListAvailableSlots(ctx context.Context, masterID, serviceID int64, day time.Time, loc *time.Location) ([]Slot, error)
+	// ListMasterLoad — загрузка мастеров masterIDs: записи с началом в [from, to) и последняя назначенная
+	ListMasterLoad(ctx context.Context, masterIDs []int64, from, to time.Time) ([]MasterLoad, error)
+
+	// Слоты (на основании working_hours, особых часов, отпусков, выходных и праздников,
+	// существующих записей и чужих удержаний)
+	ListAvailableSlots(ctx context.Context, q SlotQuery) ([]Slot, error)
+	// ListFreeDays — дни с q.Day по last (календарные даты в q.Loc), на которые есть свободное время;
+	// расписание и занятость загружаются разом на весь диапазон
+	ListFreeDays(ctx context.Context, q SlotQuery, last time.Time) ([]time.Time, error)
+	// HoldSlot удерживает слот за пользователем (заменяя его прежнее удержание);
+	// занятый записью или чужим удержанием — ErrSlotTaken
+	HoldSlot(ctx context.Context, h SlotHold) error
+	ReleaseHold(ctx context.Context, tgUserID int64) error
 
 	// Бронирование
 	CreateAppointment(ctx context.Context, a Appointment) (int64, error)
-	CancelAppointment(ctx context.Context, id int64) error
-	ListUserAppointmentsUpcoming(ctx context.Context, userID int64, limit int) ([]Appointment, error)
+	// CancelAppointment отменяет активную запись пользователя userID, начинающуюся после cutoff;
+	// поздно — ErrChangeDeadline, чужая или неактивная — ErrNotFound
+	CancelAppointment(ctx context.Context, id, userID int64, cutoff time.Time) error
+	// RescheduleAppointment переносит активную запись пользователя userID, начинающуюся после cutoff,
+	// на новое время; занятое время — ErrSlotTaken, поздно — ErrChangeDeadline,
+	// чужая или неактивная запись — ErrNotFound
+	RescheduleAppointment(ctx context.Context, id, userID int64, startAt, endAt, cutoff time.Time) error
+	// MarkNoShow помечает начавшуюся активную запись как неявку; иначе ErrNotFound
+	MarkNoShow(ctx context.Context, id int64) error
+	GetAppointmentDetails(ctx context.Context, id int64) (*AppointmentDetails, error)
+	// ClaimChannelPost закрепляет публикацию поста о записи за вызывающим на lease;
+	// false — пост уже опубликован или его сейчас публикует другой отправитель
+	ClaimChannelPost(ctx context.Context, id int64, lease time.Duration) (bool, error)
+	SetChannelMessageID(ctx context.Context, id int64, messageID int) error
+	ListUserAppointmentsUpcoming(ctx context.Context, userID int64, limit int) ([]AppointmentDetails, error)
+
+	// Идемпотентность подтверждения: ключ кнопки «Подтвердить» → созданная запись (0 — ключ не использован)
+	SaveConfirmKey(ctx context.Context, key string, tgUserID, appointmentID int64) error
+	GetConfirmedAppointment(ctx context.Context, key string, tgUserID int64) (int64, error)
+
+	// Дедупликация апдейтов: UpdateProcessed — обработан ли уже апдейт или callback,
+	// SaveProcessedUpdate записывает их после успешной обработки
+	UpdateProcessed(ctx context.Context, updateID int, callbackID string) (bool, error)
+	SaveProcessedUpdate(ctx context.Context, updateID int, callbackID string) error
+	PurgeUpdates(ctx context.Context, before time.Time) error
+
+	// Напоминания: ListDueReminders — записи, которым пора напомнить за lead, пока до начала
+	// больше until (дальше пора следующего, более короткого напоминания); ClaimReminder атомарно
+	// помечает напоминание отправленным (false — уже отправлено), ReleaseReminder снимает отметку,
+	// если отправка не удалась
+	ListDueReminders(ctx context.Context, lead, until time.Duration, now time.Time, limit int) ([]Reminder, error)
+	ClaimReminder(ctx context.Context, appointmentID int64, leadMin int) (bool, error)
+	ReleaseReminder(ctx context.Context, appointmentID int64, leadMin int) error
+
+	// Outbox: ClaimOutbox захватывает готовые к отправке сообщения на lease;
+	// MarkOutboxFailed с retryAt=nil прекращает попытки
+	EnqueueOutbox(ctx context.Context, msgs ...OutboxMessage) error
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	MarkOutboxSent(ctx context.Context, id int64) error
+	MarkOutboxFailed(ctx context.Context, id int64, lastErr string, retryAt *time.Time) error
 
 	// FSM-сессия
 	LoadSession(ctx context.Context, userID int64) (*SessionData, error)
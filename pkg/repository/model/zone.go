@@ -0,0 +1,30 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// zones — загруженные часовые пояса филиалов по имени.
+var zones sync.Map
+
+// Zone возвращает часовой пояс с именем IANA name или def, если имя пустое или неизвестно.
+func Zone(name string, def *time.Location) *time.Location {
+	if name == "" {
+		return def
+	}
+	if loc, ok := zones.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return def
+	}
+	zones.Store(name, loc)
+	return loc
+}
+
+// Zone — часовой пояс филиала или def, если он не задан или неизвестен.
+func (l Location) Zone(def *time.Location) *time.Location {
+	return Zone(l.Timezone, def)
+}